@@ -0,0 +1,95 @@
+package statly
+
+// ErrorContextProvider is implemented by errors that carry structured data,
+// such as error codes or resource IDs. The data is added to the "error"
+// context of events captured from the error or any error wrapping it.
+type ErrorContextProvider interface {
+	StatlyContext() map[string]interface{}
+}
+
+// ErrorTagsProvider is implemented by errors that carry tags for the events
+// captured from them.
+type ErrorTagsProvider interface {
+	StatlyTags() map[string]string
+}
+
+// ErrorFingerprintProvider is implemented by errors that decide how their
+// events are grouped. The fingerprint may contain DefaultFingerprint.
+type ErrorFingerprintProvider interface {
+	StatlyFingerprint() []string
+}
+
+// applyErrorAttributes merges the contexts, tags and fingerprints provided by
+// the errors in the chain of err into the event. Errors closer to the
+// captured error take precedence over the errors they wrap.
+func applyErrorAttributes(event *Event, err error, maxDepth int) {
+	errorContext := make(map[string]interface{})
+
+	walkErrorChain(err, maxDepth, func(err error) {
+		// Methods of foreign error types must not break the capture
+		defer func() {
+			recover()
+		}()
+
+		if e, ok := err.(ErrorContextProvider); ok {
+			for k, v := range e.StatlyContext() {
+				if _, exists := errorContext[k]; !exists {
+					errorContext[k] = v
+				}
+			}
+		}
+
+		if e, ok := err.(ErrorTagsProvider); ok {
+			for k, v := range e.StatlyTags() {
+				if _, exists := event.Tags[k]; !exists {
+					event.Tags[k] = v
+				}
+			}
+		}
+
+		if e, ok := err.(ErrorFingerprintProvider); ok && event.Fingerprint == nil {
+			if fingerprint := e.StatlyFingerprint(); len(fingerprint) > 0 {
+				event.Fingerprint = append([]string(nil), fingerprint...)
+			}
+		}
+	})
+
+	if len(errorContext) > 0 {
+		event.Contexts["error"] = errorContext
+	}
+}
+
+// walkErrorChain calls f for err and every error it wraps, outermost first,
+// following the chain up to maxDepth levels deep.
+func walkErrorChain(err error, maxDepth int, f func(error)) {
+	visited := 0
+
+	var walk func(err error, depth int)
+	walk = func(err error, depth int) {
+		if visited >= maxErrorChainLength {
+			return
+		}
+		visited++
+
+		f(err)
+
+		if depth >= maxDepth {
+			return
+		}
+
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, child := range e.Unwrap() {
+				if child != nil {
+					walk(child, depth+1)
+				}
+			}
+		case interface{ Unwrap() error }:
+			if child := e.Unwrap(); child != nil {
+				walk(child, depth+1)
+			}
+		}
+	}
+
+	walk(err, 0)
+}
@@ -1,23 +1,40 @@
 package statly
 
 import (
+	"log"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Client is the main client for capturing and sending events to Statly.
 type Client struct {
-	options   Options
-	transport Transport
-	scope     *Scope
-	mu        sync.RWMutex
+	options         Options
+	transport       Transport
+	hub             *Hub
+	eventProcessors []EventProcessor
+	integrations    map[string]Integration
+	deduper         *deduper
+	inApp           *inAppResolver
+	closed          atomic.Bool
+	mu              sync.RWMutex
 }
 
 // NewClient creates a new Statly client.
 func NewClient(options Options) (*Client, error) {
-	if options.DSN == "" {
-		return nil, ErrMissingDSN
+	if _, err := ParseDSN(options.DSN); err != nil {
+		return nil, err
+	}
+	for _, dest := range options.Destinations {
+		if dest.Transport == nil {
+			if dest.DSN == "" {
+				return nil, ErrInvalidDestination
+			}
+			if _, err := ParseDSN(dest.DSN); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Set defaults
@@ -33,6 +50,27 @@ func NewClient(options Options) (*Client, error) {
 	if options.ServerName == "" {
 		options.ServerName = getHostname()
 	}
+	if options.MaxErrorDepth == 0 {
+		options.MaxErrorDepth = DefaultMaxErrorDepth
+	}
+	if options.MaxStackFrames == 0 {
+		options.MaxStackFrames = DefaultMaxStackFrames
+	}
+	if options.Limits.MaxStringLength == 0 {
+		options.Limits.MaxStringLength = DefaultMaxStringLength
+	}
+	if options.Limits.MaxBreadth == 0 {
+		options.Limits.MaxBreadth = DefaultMaxBreadth
+	}
+	if options.Limits.MaxDepth == 0 {
+		options.Limits.MaxDepth = DefaultMaxDepth
+	}
+	if options.Limits.MaxEventSize == 0 {
+		options.Limits.MaxEventSize = DefaultMaxEventSize
+	}
+	if options.DedupeWindow == 0 {
+		options.DedupeWindow = 30 * time.Second
+	}
 
 	// Create transport
 	var transport Transport
@@ -46,13 +84,25 @@ func NewClient(options Options) (*Client, error) {
 		})
 	}
 
+	if len(options.Destinations) > 0 {
+		destinations := append([]Destination{{Transport: transport}}, options.Destinations...)
+		transport = NewFanoutTransport(destinations, TransportOptions{
+			Timeout: 30 * time.Second,
+			Debug:   options.Debug,
+		})
+	}
+
 	client := &Client{
 		options:   options,
 		transport: transport,
-		scope:     NewScope(),
+		inApp:     newInAppResolver(options.InAppInclude, options.InAppExclude),
 	}
 
-	client.scope.maxBreadcrumbs = options.MaxBreadcrumbs
+	scope := NewScope()
+	scope.maxBreadcrumbs = options.MaxBreadcrumbs
+	client.hub = NewHub(client, scope)
+
+	client.setupIntegrations()
 
 	return client, nil
 }
@@ -64,7 +114,30 @@ func (c *Client) CaptureException(err error) string {
 
 // CaptureExceptionWithContext captures an error with additional context.
 func (c *Client) CaptureExceptionWithContext(err error, ctx map[string]interface{}) string {
-	if err == nil {
+	return c.hub.CaptureExceptionWithContext(err, ctx)
+}
+
+// CaptureExceptionWithHint captures an error and passes the hint to event
+// processors and BeforeSend.
+func (c *Client) CaptureExceptionWithHint(err error, hint *EventHint) string {
+	return c.hub.CaptureExceptionWithHint(err, hint)
+}
+
+// captureException builds an exception event and applies the given scope.
+func (c *Client) captureException(err error, ctx map[string]interface{}, hint *EventHint, scope *Scope) string {
+	if err == nil || !c.IsEnabled() {
+		return ""
+	}
+
+	if hint == nil {
+		hint = &EventHint{}
+	}
+	if hint.OriginalException == nil {
+		hint.OriginalException = err
+	}
+
+	// Skip building events the transport would drop
+	if c.isRateLimited(CategoryError) {
 		return ""
 	}
 
@@ -73,12 +146,57 @@ func (c *Client) CaptureExceptionWithContext(err error, ctx map[string]interface
 		return ""
 	}
 
-	// Build event
-	event := NewExceptionEvent(err)
+	return c.captureExceptionEvent(newExceptionEvent(err, c.options.MaxErrorDepth), ctx, hint, scope)
+}
+
+// CapturePanic captures a value recovered from a panic. Call it from the
+// deferred function that recovered the panic.
+func (c *Client) CapturePanic(r interface{}) string {
+	return c.hub.CapturePanic(r)
+}
+
+// CapturePanicWithHint captures a value recovered from a panic and passes the
+// hint to event processors and BeforeSend.
+func (c *Client) CapturePanicWithHint(r interface{}, hint *EventHint) string {
+	return c.hub.CapturePanicWithHint(r, hint)
+}
+
+// capturePanic captures a recovered panic as an unhandled exception.
+func (c *Client) capturePanic(r interface{}, ctx map[string]interface{}, hint *EventHint, scope *Scope) string {
+	if r == nil || !c.IsEnabled() {
+		return ""
+	}
+
+	if hint == nil {
+		hint = &EventHint{}
+	}
+	if hint.RecoveredValue == nil {
+		hint.RecoveredValue = r
+	}
+	if err, ok := r.(error); ok && hint.OriginalException == nil {
+		hint.OriginalException = err
+	}
+
+	// Skip building events the transport would drop
+	if c.isRateLimited(CategoryError) {
+		return ""
+	}
+
+	// Sample rate check
+	if rand.Float64() > c.options.SampleRate {
+		return ""
+	}
+
+	return c.captureExceptionEvent(newPanicEvent(r, hint.Mechanism, c.options.MaxErrorDepth), ctx, hint, scope)
+}
+
+// captureExceptionEvent enriches an exception event and processes it.
+func (c *Client) captureExceptionEvent(event *Event, ctx map[string]interface{}, hint *EventHint, scope *Scope) string {
+	c.inApp.apply(event)
+	limitFrames(event, c.options.MaxStackFrames)
 	event.Environment = c.options.Environment
 	event.Release = c.options.Release
 	event.ServerName = c.options.ServerName
-	event.Contexts["runtime"] = getRuntimeInfo()
 
 	// Add extra context
 	if ctx != nil {
@@ -87,12 +205,7 @@ func (c *Client) CaptureExceptionWithContext(err error, ctx map[string]interface
 		}
 	}
 
-	// Apply scope
-	c.mu.RLock()
-	c.scope.ApplyToEvent(event)
-	c.mu.RUnlock()
-
-	return c.sendEvent(event)
+	return c.processEvent(event, hint, scope)
 }
 
 // CaptureMessage captures a message and sends it to Statly.
@@ -102,6 +215,26 @@ func (c *Client) CaptureMessage(message string, level Level) string {
 
 // CaptureMessageWithContext captures a message with additional context.
 func (c *Client) CaptureMessageWithContext(message string, level Level, ctx map[string]interface{}) string {
+	return c.hub.CaptureMessageWithContext(message, level, ctx)
+}
+
+// CaptureMessageWithHint captures a message and passes the hint to event
+// processors and BeforeSend.
+func (c *Client) CaptureMessageWithHint(message string, level Level, hint *EventHint) string {
+	return c.hub.CaptureMessageWithHint(message, level, hint)
+}
+
+// captureMessage builds a message event and applies the given scope.
+func (c *Client) captureMessage(message string, level Level, ctx map[string]interface{}, hint *EventHint, scope *Scope) string {
+	if !c.IsEnabled() {
+		return ""
+	}
+
+	// Skip building events the transport would drop
+	if c.isRateLimited(CategoryMessage) {
+		return ""
+	}
+
 	// Sample rate check
 	if rand.Float64() > c.options.SampleRate {
 		return ""
@@ -112,7 +245,6 @@ func (c *Client) CaptureMessageWithContext(message string, level Level, ctx map[
 	event.Environment = c.options.Environment
 	event.Release = c.options.Release
 	event.ServerName = c.options.ServerName
-	event.Contexts["runtime"] = getRuntimeInfo()
 
 	// Add extra context
 	if ctx != nil {
@@ -121,25 +253,74 @@ func (c *Client) CaptureMessageWithContext(message string, level Level, ctx map[
 		}
 	}
 
+	return c.processEvent(event, hint, scope)
+}
+
+// processEvent applies the scope and the event processors to an event and
+// sends it. Global processors run first, then client and scope processors.
+func (c *Client) processEvent(event *Event, hint *EventHint, scope *Scope) string {
+	if hint == nil {
+		hint = &EventHint{}
+	}
+
 	// Apply scope
+	if scope != nil {
+		scope.ApplyToEvent(event)
+	}
+
+	processors := getGlobalEventProcessors()
+
 	c.mu.RLock()
-	c.scope.ApplyToEvent(event)
+	processors = append(processors, c.eventProcessors...)
 	c.mu.RUnlock()
 
-	return c.sendEvent(event)
+	if scope != nil {
+		processors = append(processors, scope.getEventProcessors()...)
+	}
+
+	for _, processor := range processors {
+		event = processor(event, hint)
+		if event == nil {
+			return ""
+		}
+	}
+
+	return c.sendEvent(event, hint)
 }
 
 // sendEvent sends an event to Statly.
-func (c *Client) sendEvent(event *Event) string {
+func (c *Client) sendEvent(event *Event, hint *EventHint) string {
 	// Apply before_send callback
 	if c.options.BeforeSend != nil {
-		event = c.options.BeforeSend(event)
+		event = c.options.BeforeSend(event, hint)
 		if event == nil {
 			return ""
 		}
 	}
 
-	// Send via transport
+	// Bound the size of the event, including data added by BeforeSend
+	if !trimEvent(event, c.options.Limits, c.options.MaxBreadcrumbs) {
+		if c.options.Debug {
+			log.Printf("[statly] Event exceeds the maximum event size, dropped: %s", event.EventID)
+		}
+		return ""
+	}
+
+	// Suppress duplicates
+	if c.deduper != nil && c.deduper.check(event) {
+		if c.options.Debug {
+			log.Printf("[statly] Duplicate event suppressed: %s", event.EventID)
+		}
+		return ""
+	}
+
+	// Send via transport, passing the hint on to destination filters
+	if t, ok := c.transport.(hintedTransport); ok {
+		if t.sendWithHint(event, hint) {
+			return event.EventID
+		}
+		return ""
+	}
 	if c.transport.Send(event) {
 		return event.EventID
 	}
@@ -147,47 +328,125 @@ func (c *Client) sendEvent(event *Event) string {
 	return ""
 }
 
-// SetUser sets the current user context.
-func (c *Client) SetUser(user User) {
+// isRateLimited reports whether the transport drops events of the category
+// because of rate limits.
+func (c *Client) isRateLimited(category Category) bool {
+	limited, ok := c.transport.(RateLimitedTransport)
+	return ok && limited.IsRateLimited(category)
+}
+
+// AddEventProcessor adds an event processor that runs for every event
+// captured by this client.
+func (c *Client) AddEventProcessor(processor EventProcessor) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.scope.SetUser(user)
+	c.eventProcessors = append(c.eventProcessors, processor)
+}
+
+// SetUser sets the current user context.
+func (c *Client) SetUser(user User) {
+	c.hub.Scope().SetUser(user)
 }
 
 // SetTag sets a tag on the current scope.
 func (c *Client) SetTag(key, value string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.scope.SetTag(key, value)
+	c.hub.Scope().SetTag(key, value)
 }
 
 // SetTags sets multiple tags on the current scope.
 func (c *Client) SetTags(tags map[string]string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.scope.SetTags(tags)
+	c.hub.Scope().SetTags(tags)
 }
 
 // SetExtra sets extra data on the current scope.
 func (c *Client) SetExtra(key string, value interface{}) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.scope.SetExtra(key, value)
+	c.hub.Scope().SetExtra(key, value)
 }
 
 // AddBreadcrumb adds a breadcrumb to the current scope.
 func (c *Client) AddBreadcrumb(crumb Breadcrumb) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.scope.AddBreadcrumb(crumb)
+	c.hub.Scope().AddBreadcrumb(crumb)
+}
+
+// Hub returns the client's own hub. The client's capture methods and scope
+// setters operate on its current scope.
+func (c *Client) Hub() *Hub {
+	return c.hub
+}
+
+// WithScope executes a function with a new scope pushed on the client's hub.
+// Events captured with the client inside f carry the data set on the scope.
+func (c *Client) WithScope(f func(*Scope)) {
+	c.hub.WithScope(f)
+}
+
+// Recover captures any panic that occurs and re-panics.
+// Use this in a deferred function call.
+func (c *Client) Recover() {
+	if r := recover(); r != nil {
+		c.hub.CapturePanic(r)
+		c.Flush()
+		panic(r)
+	}
+}
+
+// RecoverAndCapture captures any panic that occurs without re-panicking, so
+// the program keeps running. Use this in a deferred function call.
+func (c *Client) RecoverAndCapture() {
+	if r := recover(); r != nil {
+		c.hub.CapturePanic(r)
+	}
+}
+
+// RecoverWithContext captures any panic with additional context.
+func (c *Client) RecoverWithContext(ctx map[string]interface{}) {
+	if r := recover(); r != nil {
+		c.hub.capturePanic(r, ctx, nil)
+		c.Flush()
+		panic(r)
+	}
 }
 
 // Flush flushes pending events.
-func (c *Client) Flush() {
-	c.transport.Flush(c.options.FlushTimeout)
+// It reports whether every event was delivered within Options.FlushTimeout.
+func (c *Client) Flush() bool {
+	return c.FlushWithTimeout(c.options.FlushTimeout)
+}
+
+// FlushWithTimeout flushes pending events and reports whether every event was
+// delivered within the timeout.
+func (c *Client) FlushWithTimeout(timeout time.Duration) bool {
+	if !c.IsEnabled() {
+		return false
+	}
+	c.sendDedupeSummaries()
+	return c.transport.Flush(timeout)
 }
 
-// Close closes the client and flushes pending events.
+// Close flushes pending events, waiting at most Options.FlushTimeout, and
+// closes the client. Events captured after Close are dropped. Calling Close
+// more than once is a no-op.
 func (c *Client) Close() {
+	if !c.closed.CompareAndSwap(false, true) {
+		return
+	}
+	c.sendDedupeSummaries()
 	c.transport.Close(c.options.FlushTimeout)
 }
+
+// IsEnabled reports whether the client captures events, i.e. it has not been
+// closed.
+func (c *Client) IsEnabled() bool {
+	return !c.closed.Load()
+}
+
+// sendDedupeSummaries sends the number of duplicates suppressed since the
+// last occurrence of each deduplicated event.
+func (c *Client) sendDedupeSummaries() {
+	if c.deduper == nil {
+		return
+	}
+	for _, summary := range c.deduper.drain() {
+		c.transport.Send(summary)
+	}
+}
@@ -0,0 +1,80 @@
+package statly
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log"
+)
+
+// DefaultCompressionThreshold is the request body size in bytes below which
+// bodies are sent uncompressed.
+const DefaultCompressionThreshold = 1024
+
+// Compressor compresses request bodies sent to Statly.
+type Compressor interface {
+	// Encoding returns the value of the Content-Encoding header for bodies
+	// compressed by the compressor, e.g. "gzip".
+	Encoding() string
+
+	// Compress returns the compressed data.
+	Compress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor compresses request bodies with gzip.
+type GzipCompressor struct {
+	// Level is the gzip compression level, e.g. gzip.BestSpeed or
+	// gzip.HuffmanOnly. Zero uses the default level.
+	Level int
+
+	// NoCompression stores bodies in gzip format without compressing them,
+	// like gzip.NoCompression, which Level cannot select because it is
+	// zero. Level is ignored when it is set.
+	NoCompression bool
+}
+
+// Encoding returns "gzip".
+func (c GzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+// Compress compresses data with gzip.
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if c.NoCompression {
+		level = gzip.NoCompression
+	} else if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressBody compresses a request body with the configured compressor. It
+// returns the body and its content encoding, which is empty when the body is
+// sent as it is because it is small or could not be compressed.
+func compressBody(data []byte, options TransportOptions) ([]byte, string) {
+	if options.Compressor == nil || len(data) < options.CompressionThreshold {
+		return data, ""
+	}
+
+	compressed, err := options.Compressor.Compress(data)
+	if err != nil {
+		if options.Debug {
+			log.Printf("[statly] Failed to compress request body, sending it uncompressed: %v", err)
+		}
+		return data, ""
+	}
+
+	return compressed, options.Compressor.Encoding()
+}
@@ -0,0 +1,80 @@
+package statly
+
+import (
+	"context"
+)
+
+// contextKey is the type of keys used to store values on a context.
+type contextKey int
+
+const hubContextKey contextKey = iota
+
+// SetHubOnContext returns a copy of ctx that carries the given hub.
+func SetHubOnContext(ctx context.Context, hub *Hub) context.Context {
+	return context.WithValue(ctx, hubContextKey, hub)
+}
+
+// GetHubFromContext returns the hub stored on ctx, or nil if there is none.
+func GetHubFromContext(ctx context.Context) *Hub {
+	if ctx == nil {
+		return nil
+	}
+	if hub, ok := ctx.Value(hubContextKey).(*Hub); ok {
+		return hub
+	}
+	return nil
+}
+
+// HasHubOnContext reports whether ctx carries a hub.
+func HasHubOnContext(ctx context.Context) bool {
+	return GetHubFromContext(ctx) != nil
+}
+
+// hubFromContext returns the hub stored on ctx, falling back to the current hub.
+func hubFromContext(ctx context.Context) *Hub {
+	if hub := GetHubFromContext(ctx); hub != nil {
+		return hub
+	}
+	return CurrentHub()
+}
+
+// CaptureExceptionCtx captures an error using the hub stored on ctx.
+func CaptureExceptionCtx(ctx context.Context, err error) string {
+	return hubFromContext(ctx).CaptureExceptionWithHint(err, &EventHint{Context: ctx})
+}
+
+// CaptureExceptionWithContextCtx captures an error with additional context
+// using the hub stored on ctx.
+func CaptureExceptionWithContextCtx(ctx context.Context, err error, extra map[string]interface{}) string {
+	return hubFromContext(ctx).captureException(err, extra, &EventHint{Context: ctx})
+}
+
+// CaptureMessageCtx captures a message using the hub stored on ctx.
+func CaptureMessageCtx(ctx context.Context, message string, level Level) string {
+	return hubFromContext(ctx).CaptureMessageWithHint(message, level, &EventHint{Context: ctx})
+}
+
+// SetUserCtx sets the user on the scope of the hub stored on ctx.
+func SetUserCtx(ctx context.Context, user User) {
+	hubFromContext(ctx).SetUser(user)
+}
+
+// SetTagCtx sets a tag on the scope of the hub stored on ctx.
+func SetTagCtx(ctx context.Context, key, value string) {
+	hubFromContext(ctx).SetTag(key, value)
+}
+
+// SetTagsCtx sets multiple tags on the scope of the hub stored on ctx.
+func SetTagsCtx(ctx context.Context, tags map[string]string) {
+	hubFromContext(ctx).SetTags(tags)
+}
+
+// SetExtraCtx sets extra data on the scope of the hub stored on ctx.
+func SetExtraCtx(ctx context.Context, key string, value interface{}) {
+	hubFromContext(ctx).SetExtra(key, value)
+}
+
+// AddBreadcrumbCtx adds a breadcrumb to the scope of the hub stored on ctx.
+func AddBreadcrumbCtx(ctx context.Context, crumb Breadcrumb) {
+	hubFromContext(ctx).AddBreadcrumb(crumb)
+}
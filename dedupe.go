@@ -0,0 +1,130 @@
+package statly
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// dedupeEntry tracks an event that was recently sent.
+type dedupeEntry struct {
+	event      *Event
+	first      time.Time
+	suppressed int
+}
+
+// deduper suppresses identical exception events within a time window.
+type deduper struct {
+	mu        sync.Mutex
+	window    time.Duration
+	entries   map[string]*dedupeEntry
+	lastPrune time.Time
+}
+
+// newDeduper creates a deduper with the given window.
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{
+		window:    window,
+		entries:   make(map[string]*dedupeEntry),
+		lastPrune: time.Now(),
+	}
+}
+
+// check reports whether the event duplicates one sent within the window.
+// Events are duplicates when their exception types, values and stack traces
+// match, so the same error value captured at different call sites is not
+// suppressed. Events that are not duplicates carry the number of duplicates
+// suppressed since the previous occurrence.
+func (d *deduper) check(event *Event) bool {
+	if len(event.Exception) == 0 {
+		return false
+	}
+
+	key := exceptionFingerprint(event)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.prune(now)
+
+	suppressed := 0
+	if entry, ok := d.entries[key]; ok {
+		if now.Sub(entry.first) < d.window {
+			entry.suppressed++
+			return true
+		}
+		suppressed = entry.suppressed
+	}
+
+	if suppressed > 0 {
+		event.Contexts["deduplication"] = map[string]interface{}{
+			"suppressed": suppressed,
+			"window_ms":  d.window.Milliseconds(),
+		}
+	}
+
+	d.entries[key] = &dedupeEntry{event: event.clone(), first: now}
+
+	return false
+}
+
+// drain returns summary events for duplicates suppressed since the last
+// occurrence of each event and resets their counts.
+func (d *deduper) drain() []*Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var summaries []*Event
+
+	for _, entry := range d.entries {
+		if entry.suppressed == 0 {
+			continue
+		}
+
+		summary := entry.event.clone()
+		summary.EventID = generateEventID()
+		summary.Timestamp = time.Now().UTC()
+		summary.Contexts["deduplication"] = map[string]interface{}{
+			"suppressed": entry.suppressed,
+			"window_ms":  d.window.Milliseconds(),
+		}
+		summaries = append(summaries, summary)
+
+		entry.suppressed = 0
+	}
+
+	return summaries
+}
+
+// prune removes expired entries that have no suppressed duplicates.
+func (d *deduper) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < d.window {
+		return
+	}
+	d.lastPrune = now
+
+	for key, entry := range d.entries {
+		if entry.suppressed == 0 && now.Sub(entry.first) >= d.window {
+			delete(d.entries, key)
+		}
+	}
+}
+
+// exceptionFingerprint returns a key identifying the exception type, value
+// and stack trace of an event.
+func exceptionFingerprint(event *Event) string {
+	h := fnv.New64a()
+
+	for _, exc := range event.Exception {
+		fmt.Fprintf(h, "%s\x00%s\x00", exc.Type, exc.Value)
+		if exc.Stacktrace != nil {
+			for _, frame := range exc.Stacktrace.Frames {
+				fmt.Fprintf(h, "%s\x00%s\x00%d\x00", frame.Filename, frame.Function, frame.Lineno)
+			}
+		}
+	}
+
+	return fmt.Sprintf("exception:%x", h.Sum64())
+}
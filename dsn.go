@@ -0,0 +1,109 @@
+package statly
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DSN is a parsed Data Source Name. Its format is
+//
+//	https://<api-key>@<host>[:<port>][/<path-prefix>]/<org-slug>[?<options>]
+//
+// The http scheme is accepted for local stand-in servers.
+type DSN struct {
+	Scheme string
+	Key    string
+
+	// Host is the host and optional port.
+	Host string
+
+	// PathPrefix is the path Statly is served under, without a trailing
+	// slash, e.g. "/statly" for a server behind a reverse proxy.
+	PathPrefix string
+	Org        string
+
+	// Query holds the options given in the query string.
+	Query url.Values
+}
+
+// ParseDSN parses and validates a DSN. The returned error wraps
+// ErrInvalidDSN.
+func ParseDSN(raw string) (*DSN, error) {
+	if raw == "" {
+		return nil, ErrMissingDSN
+	}
+
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		// Avoid echoing the key in the error
+		return nil, fmt.Errorf("%w: malformed URL", ErrInvalidDSN)
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidDSN, u.Scheme)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("%w: missing API key", ErrInvalidDSN)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: missing host", ErrInvalidDSN)
+	}
+	if port := u.Port(); port == "" && strings.HasSuffix(u.Host, ":") {
+		return nil, fmt.Errorf("%w: empty port", ErrInvalidDSN)
+	}
+	if u.Fragment != "" {
+		return nil, fmt.Errorf("%w: unexpected fragment", ErrInvalidDSN)
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	org := path[idx+1:]
+	if org == "" {
+		return nil, fmt.Errorf("%w: missing org slug", ErrInvalidDSN)
+	}
+
+	return &DSN{
+		Scheme:     u.Scheme,
+		Key:        u.User.Username(),
+		Host:       u.Host,
+		PathPrefix: path[:idx],
+		Org:        org,
+		Query:      u.Query(),
+	}, nil
+}
+
+// String returns the DSN, including its key.
+func (d *DSN) String() string {
+	u := url.URL{
+		Scheme:   d.Scheme,
+		User:     url.User(d.Key),
+		Host:     d.Host,
+		Path:     d.PathPrefix + "/" + d.Org,
+		RawQuery: d.Query.Encode(),
+	}
+	return u.String()
+}
+
+// baseURL returns the URL Statly is served under.
+func (d *DSN) baseURL() string {
+	return d.Scheme + "://" + d.Host + d.PathPrefix
+}
+
+// IngestURL returns the URL events are posted to.
+func (d *DSN) IngestURL() string {
+	return d.baseURL() + "/api/v1/observe/ingest"
+}
+
+// EnvelopeURL returns the URL envelopes are posted to.
+func (d *DSN) EnvelopeURL() string {
+	return d.baseURL() + "/api/v1/observe/envelope"
+}
+
+// setAuthHeaders authenticates a request with the key of the DSN. The rest
+// of the DSN is not sent.
+func (d *DSN) setAuthHeaders(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+d.Key)
+	req.Header.Set("X-Statly-Org", d.Org)
+}
@@ -0,0 +1,370 @@
+package statly
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EnvelopeContentType is the content type of encoded envelopes.
+const EnvelopeContentType = "application/x-statly-envelope"
+
+// ItemType is the type of an envelope item.
+type ItemType string
+
+// Envelope item types.
+const (
+	ItemEvent        ItemType = "event"
+	ItemTransaction  ItemType = "transaction"
+	ItemSession      ItemType = "session"
+	ItemCheckIn      ItemType = "check_in"
+	ItemAttachment   ItemType = "attachment"
+	ItemClientReport ItemType = "client_report"
+)
+
+// Envelope carries items of different types, such as events, sessions and
+// attachments, to Statly in one request.
+//
+// An envelope is encoded as a JSON header line followed by its items. Each
+// item is a JSON header line followed by its payload and a newline. The item
+// header holds the payload length, so payloads may contain newlines and
+// binary data:
+//
+//	{"event_id":"...","sdk":{"name":"statly-observe-go","version":"..."}}
+//	{"type":"event","length":42}
+//	{"event_id":"...","level":"error",...}
+//	{"type":"attachment","length":5,"filename":"a.txt","content_type":"text/plain"}
+//	hello
+type Envelope struct {
+	Header EnvelopeHeader
+	Items  []EnvelopeItem
+}
+
+// EnvelopeHeader holds the metadata of an envelope.
+type EnvelopeHeader struct {
+	// EventID is the ID of the event the items of the envelope belong to,
+	// if any.
+	EventID string  `json:"event_id,omitempty"`
+	SDK     SDKInfo `json:"sdk"`
+}
+
+// EnvelopeItem is an item of an envelope.
+type EnvelopeItem struct {
+	Header  EnvelopeItemHeader
+	Payload []byte
+}
+
+// EnvelopeItemHeader describes the payload of an envelope item.
+type EnvelopeItemHeader struct {
+	Type        ItemType `json:"type"`
+	Length      int      `json:"length"`
+	Filename    string   `json:"filename,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+}
+
+// NewEnvelope creates an empty envelope.
+func NewEnvelope() *Envelope {
+	return &Envelope{
+		Header: EnvelopeHeader{
+			SDK: SDKInfo{
+				Name:    "statly-observe-go",
+				Version: Version,
+			},
+		},
+	}
+}
+
+// AddItem adds an item with the given payload.
+func (e *Envelope) AddItem(itemType ItemType, payload []byte) {
+	e.Items = append(e.Items, EnvelopeItem{
+		Header:  EnvelopeItemHeader{Type: itemType, Length: len(payload)},
+		Payload: payload,
+	})
+}
+
+// AddJSON adds an item whose payload is v encoded as JSON.
+func (e *Envelope) AddJSON(itemType ItemType, v interface{}) error {
+	payload, err := safeMarshal(v)
+	if err != nil {
+		return err
+	}
+	e.AddItem(itemType, payload)
+	return nil
+}
+
+// AddEvent adds an event item. The envelope is tied to the first event added
+// to it.
+func (e *Envelope) AddEvent(event *Event) error {
+	if err := e.AddJSON(ItemEvent, event); err != nil {
+		return err
+	}
+	if e.Header.EventID == "" {
+		e.Header.EventID = event.EventID
+	}
+	return nil
+}
+
+// AddAttachment adds a file attached to the envelope's event.
+func (e *Envelope) AddAttachment(filename, contentType string, data []byte) {
+	e.Items = append(e.Items, EnvelopeItem{
+		Header: EnvelopeItemHeader{
+			Type:        ItemAttachment,
+			Length:      len(data),
+			Filename:    filename,
+			ContentType: contentType,
+		},
+		Payload: data,
+	})
+}
+
+// Encode writes the envelope to w.
+func (e *Envelope) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	header, err := json.Marshal(e.Header)
+	if err != nil {
+		return err
+	}
+	bw.Write(header)
+	bw.WriteByte('\n')
+
+	for _, item := range e.Items {
+		item.Header.Length = len(item.Payload)
+		header, err := json.Marshal(item.Header)
+		if err != nil {
+			return err
+		}
+		bw.Write(header)
+		bw.WriteByte('\n')
+		bw.Write(item.Payload)
+		bw.WriteByte('\n')
+	}
+
+	return bw.Flush()
+}
+
+// MarshalBinary returns the encoded envelope.
+func (e *Envelope) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeEnvelope reads an envelope from r. An item header without a length
+// takes the rest of its line as the payload. Negative lengths and lengths
+// beyond the end of the input are errors.
+func DecodeEnvelope(r io.Reader) (*Envelope, error) {
+	br := bufio.NewReader(r)
+
+	line, err := readEnvelopeLine(br)
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("statly: empty envelope")
+		}
+		return nil, err
+	}
+
+	envelope := &Envelope{}
+	if err := json.Unmarshal(line, &envelope.Header); err != nil {
+		return nil, fmt.Errorf("statly: invalid envelope header: %w", err)
+	}
+
+	for {
+		line, err := readEnvelopeLine(br)
+		if err == io.EOF {
+			return envelope, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		var item EnvelopeItem
+		if err := json.Unmarshal(line, &item.Header); err != nil {
+			return nil, fmt.Errorf("statly: invalid envelope item header: %w", err)
+		}
+
+		if item.Header.Length < 0 {
+			return nil, fmt.Errorf("statly: invalid envelope item length %d", item.Header.Length)
+		}
+
+		if item.Header.Length > 0 {
+			// Read the payload as it arrives rather than allocating the
+			// declared length, which may exceed the input
+			var payload bytes.Buffer
+			if _, err := io.CopyN(&payload, br, int64(item.Header.Length)); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, fmt.Errorf("statly: truncated envelope item: %w", err)
+			}
+			item.Payload = payload.Bytes()
+			// Consume the newline ending the payload
+			if b, err := br.ReadByte(); err == nil && b != '\n' {
+				br.UnreadByte()
+			}
+		} else {
+			payload, err := readEnvelopeLine(br)
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			item.Payload = payload
+			item.Header.Length = len(payload)
+		}
+
+		envelope.Items = append(envelope.Items, item)
+	}
+}
+
+// readEnvelopeLine reads a line without its newline. It returns io.EOF only
+// when no data is left.
+func readEnvelopeLine(br *bufio.Reader) ([]byte, error) {
+	line, err := br.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r")), nil
+}
+
+// EnvelopeTransport is implemented by transports that can send envelopes.
+// Envelopes share the retries, rate limits and spool of the transport's
+// events, and may be batched like them: envelopes whose items do not belong
+// to different events can be merged into one request.
+type EnvelopeTransport interface {
+	SendEnvelope(envelope *Envelope) bool
+}
+
+// itemCategory returns the rate limit category of an envelope item. Client
+// reports are only limited when every category is.
+func itemCategory(item EnvelopeItem) Category {
+	switch item.Header.Type {
+	case ItemEvent:
+		return recordCategory(item.Payload)
+	case ItemTransaction:
+		return CategoryTransaction
+	case ItemSession:
+		return CategorySession
+	case ItemCheckIn:
+		return CategoryCheckIn
+	case ItemAttachment:
+		return CategoryAttachment
+	}
+	return categoryAll
+}
+
+// withoutLimited returns a copy of the envelope without the items of rate
+// limited categories, or nil if every item is limited.
+func (e *Envelope) withoutLimited(limits *rateLimits) *Envelope {
+	allowed, _ := e.splitLimited(limits)
+	return allowed
+}
+
+// canMerge reports whether the items of other can be sent in the same
+// envelope as those of e. Items of different events cannot, nor can
+// attachments of no event join an envelope tied to one.
+func (e *Envelope) canMerge(other *Envelope) bool {
+	switch {
+	case e.Header.EventID == other.Header.EventID:
+		return true
+	case e.Header.EventID == "":
+		return !e.hasItem(ItemAttachment)
+	case other.Header.EventID == "":
+		return !other.hasItem(ItemAttachment)
+	}
+	return false
+}
+
+// hasItem reports whether the envelope holds an item of the given type.
+func (e *Envelope) hasItem(itemType ItemType) bool {
+	for _, item := range e.Items {
+		if item.Header.Type == itemType {
+			return true
+		}
+	}
+	return false
+}
+
+// merge returns an envelope holding the items of e followed by those of
+// other. The envelopes must be mergeable.
+func (e *Envelope) merge(other *Envelope) *Envelope {
+	out := &Envelope{Header: e.Header}
+	if out.Header.EventID == "" {
+		out.Header.EventID = other.Header.EventID
+	}
+	out.Items = make([]EnvelopeItem, 0, len(e.Items)+len(other.Items))
+	out.Items = append(out.Items, e.Items...)
+	out.Items = append(out.Items, other.Items...)
+	return out
+}
+
+// mergeEnvelopes merges consecutive envelopes that can share a request,
+// keeping the order of their items.
+func mergeEnvelopes(envelopes []*Envelope) []*Envelope {
+	var merged []*Envelope
+	for _, envelope := range envelopes {
+		if n := len(merged); n > 0 && merged[n-1].canMerge(envelope) {
+			merged[n-1] = merged[n-1].merge(envelope)
+		} else {
+			merged = append(merged, envelope)
+		}
+	}
+	return merged
+}
+
+// splitLimited returns copies of the envelope holding the items of categories
+// that are not rate limited and the items of those that are. Either is nil
+// when it holds no items.
+func (e *Envelope) splitLimited(limits *rateLimits) (allowed, limited *Envelope) {
+	allowed = &Envelope{Header: e.Header}
+	limited = &Envelope{Header: e.Header}
+	for _, item := range e.Items {
+		if limits.isLimited(itemCategory(item)) {
+			limited.Items = append(limited.Items, item)
+		} else {
+			allowed.Items = append(allowed.Items, item)
+		}
+	}
+
+	if len(allowed.Items) == 0 {
+		allowed = nil
+	}
+	if len(limited.Items) == 0 {
+		limited = nil
+	}
+	return allowed, limited
+}
+
+// filterEvents returns a copy of the envelope whose event items were passed
+// through f. Events f drops are removed.
+func (e *Envelope) filterEvents(f func(*Event) *Event) *Envelope {
+	out := &Envelope{Header: e.Header}
+	for _, item := range e.Items {
+		if item.Header.Type != ItemEvent {
+			out.Items = append(out.Items, item)
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(item.Payload, &event); err != nil {
+			continue
+		}
+		filtered := f(&event)
+		if filtered == nil {
+			continue
+		}
+		if err := out.AddJSON(ItemEvent, filtered); err != nil {
+			continue
+		}
+	}
+	return out
+}
@@ -5,6 +5,8 @@ import "errors"
 // Common errors returned by the SDK.
 var (
 	ErrMissingDSN       = errors.New("statly: DSN is required")
+	ErrInvalidDSN       = errors.New("statly: invalid DSN")
+	ErrInvalidDestination = errors.New("statly: destination needs a DSN or a Transport")
 	ErrNotInitialized   = errors.New("statly: SDK not initialized, call Init() first")
 	ErrAlreadyInitialized = errors.New("statly: SDK already initialized, call Close() first")
 )
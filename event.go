@@ -3,9 +3,8 @@ package statly
 import (
 	"crypto/rand"
 	"encoding/hex"
-	"errors"
 	"fmt"
-	"runtime"
+	"reflect"
 	"time"
 )
 
@@ -27,6 +26,12 @@ type Event struct {
 	Release     string                 `json:"release,omitempty"`
 	ServerName  string                 `json:"server_name,omitempty"`
 	Request     *RequestInfo           `json:"request,omitempty"`
+	Transaction string                 `json:"transaction,omitempty"`
+	Fingerprint []string               `json:"fingerprint,omitempty"`
+	Modules     map[string]string      `json:"modules,omitempty"`
+
+	// Meta records data trimmed from the event to respect the event limits.
+	Meta map[string]TrimmedValue `json:"_meta,omitempty"`
 }
 
 // ExceptionValue represents an exception in an event.
@@ -41,24 +46,39 @@ type ExceptionValue struct {
 // Stacktrace represents a stack trace.
 type Stacktrace struct {
 	Frames []StackFrame `json:"frames"`
+
+	// FramesOmitted is the range [start, end) of frames removed from the
+	// middle of the stack trace, if any.
+	FramesOmitted []int `json:"frames_omitted,omitempty"`
 }
 
 // StackFrame represents a single frame in a stack trace.
 type StackFrame struct {
 	Filename    string                 `json:"filename"`
 	Function    string                 `json:"function"`
+	Module      string                 `json:"module,omitempty"`
 	Lineno      int                    `json:"lineno,omitempty"`
 	Colno       int                    `json:"colno,omitempty"`
 	AbsPath     string                 `json:"abs_path,omitempty"`
 	ContextLine string                 `json:"context_line,omitempty"`
+	PreContext  []string               `json:"pre_context,omitempty"`
+	PostContext []string               `json:"post_context,omitempty"`
 	InApp       bool                   `json:"in_app"`
 	Vars        map[string]interface{} `json:"vars,omitempty"`
 }
 
 // Mechanism describes the mechanism that generated the exception.
+//
+// Exceptions from an error chain are linked through ExceptionID and ParentID.
+// Source describes how an exception relates to its parent, e.g. "cause" for
+// a wrapped error or "errors[1]" for a joined error.
 type Mechanism struct {
-	Type    string `json:"type"`
-	Handled bool   `json:"handled"`
+	Type             string `json:"type"`
+	Handled          bool   `json:"handled"`
+	ExceptionID      int    `json:"exception_id"`
+	ParentID         *int   `json:"parent_id,omitempty"`
+	Source           string `json:"source,omitempty"`
+	IsExceptionGroup bool   `json:"is_exception_group,omitempty"`
 }
 
 // EventUser represents user information in an event.
@@ -100,6 +120,30 @@ type RequestInfo struct {
 // SDK version
 const Version = "0.1.0"
 
+// DefaultMaxErrorDepth is the default number of wrapping levels followed when
+// recording an error chain.
+const DefaultMaxErrorDepth = 10
+
+// maxErrorChainLength caps the number of exception values per event, which
+// bounds wide trees of joined errors.
+const maxErrorChainLength = 50
+
+// Mechanism types of recovered panics.
+const (
+	// MechanismPanic is recorded for panics recovered by Recover.
+	MechanismPanic = "panic"
+
+	// MechanismHTTPServer is recorded for panics recovered while serving an
+	// HTTP request.
+	MechanismHTTPServer = "http.server"
+)
+
+// DefaultFingerprint is a fingerprint placeholder that stands for the default
+// grouping of an event. Use it to extend rather than replace default grouping:
+//
+//	scope.SetFingerprint([]string{statly.DefaultFingerprint, "payment-provider"})
+const DefaultFingerprint = "{{ default }}"
+
 // generateEventID generates a unique event ID.
 func generateEventID() string {
 	b := make([]byte, 16)
@@ -124,131 +168,325 @@ func NewEvent() *Event {
 	}
 }
 
-// NewExceptionEvent creates a new event from an error.
-func NewExceptionEvent(err error) *Event {
-	event := NewEvent()
-	event.Level = LevelError
+// clone returns a deep copy of the event that can be modified without
+// affecting the original.
+func (e *Event) clone() *Event {
+	clone := *e
 
-	// Extract exception info
-	exc := ExceptionValue{
-		Type:  getErrorType(err),
-		Value: err.Error(),
-		Mechanism: &Mechanism{
-			Type:    "generic",
-			Handled: true,
-		},
+	clone.Contexts = copyMap(e.Contexts)
+	clone.Extra = copyMap(e.Extra)
+	clone.Tags = copyStrings(e.Tags)
+	clone.Modules = copyStrings(e.Modules)
+
+	if e.Exception != nil {
+		clone.Exception = make([]ExceptionValue, len(e.Exception))
+		for i, exc := range e.Exception {
+			clone.Exception[i] = exc.clone()
+		}
 	}
 
-	// Get stack trace
-	exc.Stacktrace = captureStacktrace(3) // Skip this function and callers
+	if e.Breadcrumbs != nil {
+		clone.Breadcrumbs = make([]BreadcrumbValue, len(e.Breadcrumbs))
+		for i, crumb := range e.Breadcrumbs {
+			crumb.Data = copyMap(crumb.Data)
+			clone.Breadcrumbs[i] = crumb
+		}
+	}
 
-	event.Exception = []ExceptionValue{exc}
-	return event
-}
+	if e.Fingerprint != nil {
+		clone.Fingerprint = append([]string(nil), e.Fingerprint...)
+	}
 
-// NewMessageEvent creates a new event from a message.
-func NewMessageEvent(message string, level Level) *Event {
-	event := NewEvent()
-	event.Message = message
-	event.Level = level
-	return event
+	if e.Meta != nil {
+		clone.Meta = make(map[string]TrimmedValue, len(e.Meta))
+		for k, v := range e.Meta {
+			clone.Meta[k] = v
+		}
+	}
+
+	if e.User != nil {
+		user := *e.User
+		user.Data = copyMap(e.User.Data)
+		clone.User = &user
+	}
+
+	if e.Request != nil {
+		request := *e.Request
+		request.Headers = copyStrings(e.Request.Headers)
+		request.Env = copyStrings(e.Request.Env)
+		request.Data = deepCopy(e.Request.Data)
+		clone.Request = &request
+	}
+
+	return &clone
 }
 
-// getErrorType returns the type name of an error.
-func getErrorType(err error) string {
-	if err == nil {
-		return "unknown"
+// clone returns a deep copy of the exception.
+func (exc ExceptionValue) clone() ExceptionValue {
+	if exc.Stacktrace != nil {
+		stacktrace := *exc.Stacktrace
+		stacktrace.FramesOmitted = append([]int(nil), exc.Stacktrace.FramesOmitted...)
+		stacktrace.Frames = make([]StackFrame, len(exc.Stacktrace.Frames))
+		for i, frame := range exc.Stacktrace.Frames {
+			frame.PreContext = append([]string(nil), frame.PreContext...)
+			frame.PostContext = append([]string(nil), frame.PostContext...)
+			frame.Vars = copyMap(frame.Vars)
+			stacktrace.Frames[i] = frame
+		}
+		exc.Stacktrace = &stacktrace
 	}
 
-	// Try to unwrap to get underlying type
-	var unwrapped error = err
-	for {
-		if u := errors.Unwrap(unwrapped); u != nil {
-			unwrapped = u
-		} else {
-			break
+	if exc.Mechanism != nil {
+		mechanism := *exc.Mechanism
+		if mechanism.ParentID != nil {
+			parentID := *mechanism.ParentID
+			mechanism.ParentID = &parentID
 		}
+		exc.Mechanism = &mechanism
 	}
 
-	return fmt.Sprintf("%T", unwrapped)
+	return exc
+}
+
+// copyStrings returns a copy of a map of strings.
+func copyStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
 }
 
-// captureStacktrace captures the current stack trace.
-func captureStacktrace(skip int) *Stacktrace {
-	var frames []StackFrame
+// copyMap returns a deep copy of a map of free-form values.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	copier := valueCopier{copies: make(map[visit]reflect.Value)}
+	for k, v := range m {
+		out[k] = copier.copyInterface(v)
+	}
+	return out
+}
 
-	// Get up to 50 frames
-	pcs := make([]uintptr, 50)
-	n := runtime.Callers(skip+1, pcs)
-	pcs = pcs[:n]
+// deepCopy returns a deep copy of a free-form value.
+func deepCopy(v interface{}) interface{} {
+	copier := valueCopier{copies: make(map[visit]reflect.Value)}
+	return copier.copyInterface(v)
+}
 
-	runtimeFrames := runtime.CallersFrames(pcs)
+// valueCopier deep copies free-form values. Maps, slices, pointers and the
+// exported fields of structs are copied; channels, functions and unexported
+// fields are shared. Shared references, including cycles, are preserved.
+type valueCopier struct {
+	copies map[visit]reflect.Value
+}
 
-	for {
-		frame, more := runtimeFrames.Next()
+// copyInterface deep copies a value held in an interface.
+func (c *valueCopier) copyInterface(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return c.copy(reflect.ValueOf(v)).Interface()
+}
 
-		// Skip runtime frames
-		if frame.Function == "" {
-			if !more {
-				break
-			}
-			continue
+// copy returns a deep copy of rv with the same type.
+func (c *valueCopier) copy(rv reflect.Value) reflect.Value {
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.IsNil() {
+			return rv
 		}
+		out := reflect.New(rv.Type()).Elem()
+		out.Set(c.copy(rv.Elem()))
+		return out
 
-		// Determine if this is in-app code
-		inApp := !isStandardLibrary(frame.Function)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return rv
+		}
+		key := visit{rv.Pointer(), rv.Type()}
+		if out, ok := c.copies[key]; ok {
+			return out
+		}
+		out := reflect.New(rv.Type().Elem())
+		c.copies[key] = out
+		out.Elem().Set(c.copy(rv.Elem()))
+		return out
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return rv
+		}
+		key := visit{rv.Pointer(), rv.Type()}
+		if out, ok := c.copies[key]; ok {
+			return out
+		}
+		out := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		c.copies[key] = out
+		iter := rv.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), c.copy(iter.Value()))
+		}
+		return out
 
-		frames = append(frames, StackFrame{
-			Filename: frame.File,
-			Function: frame.Function,
-			Lineno:   frame.Line,
-			AbsPath:  frame.File,
-			InApp:    inApp,
-		})
+	case reflect.Slice:
+		if rv.IsNil() {
+			return rv
+		}
+		key := visit{rv.Pointer(), rv.Type()}
+		if out, ok := c.copies[key]; ok && out.Len() == rv.Len() {
+			return out
+		}
+		out := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		c.copies[key] = out
+		for i := 0; i < rv.Len(); i++ {
+			out.Index(i).Set(c.copy(rv.Index(i)))
+		}
+		return out
 
-		if !more {
-			break
+	case reflect.Array:
+		out := reflect.New(rv.Type()).Elem()
+		for i := 0; i < rv.Len(); i++ {
+			out.Index(i).Set(c.copy(rv.Index(i)))
+		}
+		return out
+
+	case reflect.Struct:
+		out := reflect.New(rv.Type()).Elem()
+		out.Set(rv)
+		for i := 0; i < rv.NumField(); i++ {
+			if out.Field(i).CanSet() {
+				out.Field(i).Set(c.copy(rv.Field(i)))
+			}
 		}
+		return out
 	}
 
-	// Reverse frames so innermost is first
-	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
-		frames[i], frames[j] = frames[j], frames[i]
+	return rv
+}
+
+// NewExceptionEvent creates a new event from an error.
+// Every wrapped and joined error in the chain is recorded as a linked
+// exception value.
+func NewExceptionEvent(err error) *Event {
+	return newExceptionEvent(err, DefaultMaxErrorDepth)
+}
+
+// newExceptionEvent creates a new event from an error, following the error
+// chain up to maxDepth levels deep.
+func newExceptionEvent(err error, maxDepth int) *Event {
+	event := NewEvent()
+	event.Level = LevelError
+	event.Exception = exceptionsFromError(err, maxDepth)
+	applyErrorAttributes(event, err, maxDepth)
+
+	// Fall back to the stack of the caller when the error carries none
+	if event.Exception[0].Stacktrace == nil {
+		event.Exception[0].Stacktrace = captureStacktrace(4) // Skip this function and callers
 	}
 
-	return &Stacktrace{Frames: frames}
+	return event
 }
 
-// isStandardLibrary checks if a function is from the Go standard library.
-func isStandardLibrary(function string) bool {
-	// Standard library functions typically start with common prefixes
-	prefixes := []string{
-		"runtime.",
-		"reflect.",
-		"sync.",
-		"net/",
-		"os.",
-		"io.",
-		"fmt.",
-		"encoding/",
-		"strings.",
-		"bytes.",
-		"bufio.",
-		"context.",
-		"database/",
-		"crypto/",
-		"compress/",
-		"archive/",
-		"time.",
-		"math/",
-		"testing.",
+// newPanicEvent creates a new event from a value recovered from a panic. The
+// exception is recorded as unhandled with the given mechanism type and the
+// stack of the panicking goroutine. It must be called while the panic is
+// being recovered.
+func newPanicEvent(r interface{}, mechanism string, maxDepth int) *Event {
+	event := NewEvent()
+	event.Level = LevelError
+
+	if err, ok := r.(error); ok {
+		event.Exception = exceptionsFromError(err, maxDepth)
+		applyErrorAttributes(event, err, maxDepth)
+	} else {
+		event.Exception = []ExceptionValue{{
+			Type:      fmt.Sprintf("%T", r),
+			Value:     fmt.Sprint(r),
+			Mechanism: &Mechanism{},
+		}}
+	}
+
+	if mechanism == "" {
+		mechanism = MechanismPanic
 	}
+	root := &event.Exception[0]
+	root.Mechanism.Type = mechanism
+	root.Mechanism.Handled = false
+
+	if stacktrace := capturePanicStacktrace(); stacktrace != nil {
+		root.Stacktrace = stacktrace
+	} else if root.Stacktrace == nil {
+		root.Stacktrace = captureStacktrace(2)
+	}
+
+	return event
+}
+
+// NewMessageEvent creates a new event from a message.
+func NewMessageEvent(message string, level Level) *Event {
+	event := NewEvent()
+	event.Message = message
+	event.Level = level
+	return event
+}
 
-	for _, prefix := range prefixes {
-		if len(function) >= len(prefix) && function[:len(prefix)] == prefix {
-			return true
+// exceptionsFromError returns the exception values for an error and every
+// error it wraps. The captured error comes first with exception ID 0; each
+// wrapped error links to the error wrapping it through its parent ID.
+func exceptionsFromError(err error, maxDepth int) []ExceptionValue {
+	var values []ExceptionValue
+
+	var visit func(err error, parentID int, source string, depth int)
+	visit = func(err error, parentID int, source string, depth int) {
+		if len(values) >= maxErrorChainLength {
+			return
+		}
+
+		id := len(values)
+		mechanism := &Mechanism{
+			Type:        "generic",
+			Handled:     true,
+			ExceptionID: id,
+		}
+		if parentID >= 0 {
+			parent := parentID
+			mechanism.Type = "chained"
+			mechanism.ParentID = &parent
+			mechanism.Source = source
+		}
+
+		values = append(values, ExceptionValue{
+			Type:       fmt.Sprintf("%T", err),
+			Value:      err.Error(),
+			Stacktrace: extractErrorStacktrace(err),
+			Mechanism:  mechanism,
+		})
+
+		if depth >= maxDepth {
+			return
+		}
+
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			values[id].Mechanism.IsExceptionGroup = true
+			for i, child := range e.Unwrap() {
+				if child != nil {
+					visit(child, id, fmt.Sprintf("errors[%d]", i), depth+1)
+				}
+			}
+		case interface{ Unwrap() error }:
+			if child := e.Unwrap(); child != nil {
+				visit(child, id, "cause", depth+1)
+			}
 		}
 	}
 
-	return false
+	visit(err, -1, "", 0)
+	return values
 }
@@ -0,0 +1,162 @@
+package statly
+
+import (
+	"sync"
+	"time"
+)
+
+// Destination is a target a FanoutTransport delivers events to.
+type Destination struct {
+	// DSN is the Data Source Name of the destination. It is used to create an
+	// HTTP transport when Transport is nil.
+	DSN string
+
+	// Transport is a custom transport for this destination.
+	Transport Transport
+
+	// BeforeSend is a callback to modify or drop events for this destination
+	// only. It receives a copy of the event and the hint of the capture.
+	BeforeSend func(*Event, *EventHint) *Event
+}
+
+// FanoutTransport delivers each event to several destinations.
+type FanoutTransport struct {
+	destinations []Destination
+}
+
+// NewFanoutTransport creates a transport that delivers events to every
+// destination. Destinations without a transport get an HTTP transport created
+// from options and their DSN; destinations with neither are skipped, which
+// NewClient reports as ErrInvalidDestination.
+func NewFanoutTransport(destinations []Destination, options TransportOptions) *FanoutTransport {
+	t := &FanoutTransport{
+		destinations: make([]Destination, 0, len(destinations)),
+	}
+
+	for _, dest := range destinations {
+		if dest.Transport == nil {
+			if dest.DSN == "" {
+				continue
+			}
+			destOptions := options
+			destOptions.DSN = dest.DSN
+			dest.Transport = NewHTTPTransport(destOptions)
+		}
+		t.destinations = append(t.destinations, dest)
+	}
+
+	return t
+}
+
+// hintedTransport is implemented by transports that pass the hint of a
+// capture on to their own filters.
+type hintedTransport interface {
+	sendWithHint(event *Event, hint *EventHint) bool
+}
+
+// Send delivers the event to every destination. It reports whether at least
+// one destination accepted the event.
+func (t *FanoutTransport) Send(event *Event) bool {
+	return t.sendWithHint(event, &EventHint{})
+}
+
+// sendWithHint delivers the event to every destination, passing the hint to
+// their BeforeSend callbacks.
+func (t *FanoutTransport) sendWithHint(event *Event, hint *EventHint) bool {
+	sent := false
+
+	for _, dest := range t.destinations {
+		e := event
+		if dest.BeforeSend != nil {
+			e = dest.BeforeSend(event.clone(), hint)
+			if e == nil {
+				continue
+			}
+		}
+
+		if dest.Transport.Send(e) {
+			sent = true
+		}
+	}
+
+	return sent
+}
+
+// SendEnvelope delivers the envelope to every destination that can send
+// envelopes. Destination BeforeSend callbacks apply to its event items. It
+// reports whether at least one destination accepted the envelope.
+func (t *FanoutTransport) SendEnvelope(envelope *Envelope) bool {
+	sent := false
+
+	for _, dest := range t.destinations {
+		transport, ok := dest.Transport.(EnvelopeTransport)
+		if !ok {
+			continue
+		}
+
+		e := envelope
+		if dest.BeforeSend != nil {
+			e = envelope.filterEvents(func(event *Event) *Event {
+				return dest.BeforeSend(event, &EventHint{})
+			})
+			if len(e.Items) == 0 {
+				continue
+			}
+		}
+
+		if transport.SendEnvelope(e) {
+			sent = true
+		}
+	}
+
+	return sent
+}
+
+// IsRateLimited reports whether every destination drops events of the
+// category because of rate limits.
+func (t *FanoutTransport) IsRateLimited(category Category) bool {
+	for _, dest := range t.destinations {
+		limited, ok := dest.Transport.(RateLimitedTransport)
+		if !ok || !limited.IsRateLimited(category) {
+			return false
+		}
+	}
+	return len(t.destinations) > 0
+}
+
+// Flush flushes every destination in parallel and reports whether all of
+// them delivered their events.
+func (t *FanoutTransport) Flush(timeout time.Duration) bool {
+	var wg sync.WaitGroup
+	results := make([]bool, len(t.destinations))
+
+	for i, dest := range t.destinations {
+		wg.Add(1)
+		go func(i int, transport Transport) {
+			defer wg.Done()
+			results[i] = transport.Flush(timeout)
+		}(i, dest.Transport)
+	}
+	wg.Wait()
+
+	for _, delivered := range results {
+		if !delivered {
+			return false
+		}
+	}
+	return true
+}
+
+// Close closes every destination in parallel.
+func (t *FanoutTransport) Close(timeout time.Duration) {
+	var wg sync.WaitGroup
+
+	for _, dest := range t.destinations {
+		wg.Add(1)
+		go func(transport Transport) {
+			defer wg.Done()
+			transport.Close(timeout)
+		}(dest.Transport)
+	}
+	wg.Wait()
+}
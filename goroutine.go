@@ -0,0 +1,167 @@
+package statly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// GoOptions configures a goroutine started with GoWithOptions.
+type GoOptions struct {
+	// Name identifies the goroutine in captured events.
+	Name string
+
+	// Repanic re-panics after a panic was captured, which crashes the
+	// program. By default the panic is swallowed and the goroutine ends.
+	Repanic bool
+}
+
+// Go runs f in a new goroutine with its own hub cloned from the hub on ctx.
+// A panic in f is captured and swallowed, so it does not crash the program.
+func Go(ctx context.Context, f func(ctx context.Context)) {
+	goWithOptions(ctx, GoOptions{}, f)
+}
+
+// GoWithOptions runs f in a new goroutine like Go, using the given options.
+func GoWithOptions(ctx context.Context, options GoOptions, f func(ctx context.Context)) {
+	goWithOptions(ctx, options, f)
+}
+
+// goWithOptions starts the goroutine for Go and GoWithOptions.
+func goWithOptions(ctx context.Context, options GoOptions, f func(ctx context.Context)) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	hub := hubFromContext(ctx).Clone()
+	setGoroutineContext(hub, options.Name, 3)
+	ctx = SetHubOnContext(ctx, hub)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				hub.CapturePanicWithHint(r, &EventHint{Context: ctx})
+				if options.Repanic {
+					hub.Flush()
+					panic(r)
+				}
+			}
+		}()
+
+		f(ctx)
+	}()
+}
+
+// setGoroutineContext records the goroutine name and the code that started
+// it on the hub's scope. skip is the number of stack frames above the caller
+// of setGoroutineContext to the function starting the goroutine.
+func setGoroutineContext(hub *Hub, name string, skip int) {
+	goroutine := make(map[string]interface{})
+	if name != "" {
+		goroutine["name"] = name
+	}
+	if pc, file, line, ok := runtime.Caller(skip); ok {
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			goroutine["created_by"] = fn.Name()
+		}
+		goroutine["created_at"] = fmt.Sprintf("%s:%d", file, line)
+	}
+	hub.Scope().SetContext("goroutine", goroutine)
+}
+
+// PanicError is the error returned by Group.Wait when a worker panicked.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Group runs workers in goroutines and waits for them, like errgroup.Group.
+// Each worker gets its own hub; panics and returned errors are captured.
+// The zero value is a valid group that does not cancel on error.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	hub    *Hub
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// NewGroup returns a group whose workers use hubs cloned from the hub on ctx,
+// and a derived context that is canceled when a worker fails or Wait returns.
+func NewGroup(ctx context.Context) (*Group, context.Context) {
+	hub := hubFromContext(ctx)
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Group{ctx: ctx, cancel: cancel, hub: hub}, ctx
+}
+
+// Go runs f in a new goroutine. The first error returned or panic raised by a
+// worker cancels the group's context and is returned by Wait. Errors caused
+// by the cancellation of the group's context are not captured.
+func (g *Group) Go(f func(ctx context.Context) error) {
+	ctx := g.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	hub := g.hub
+	if hub == nil {
+		hub = hubFromContext(ctx)
+	}
+
+	hub = hub.Clone()
+	setGoroutineContext(hub, "", 2)
+	ctx = SetHubOnContext(ctx, hub)
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		if err := runWorker(ctx, hub, f); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel(err)
+				}
+			})
+		}
+	}()
+}
+
+// Wait blocks until all workers have returned and returns the first error.
+// A worker that panicked is reported as a *PanicError.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel(g.err)
+	}
+	return g.err
+}
+
+// runWorker runs a group worker, capturing its error or panic.
+func runWorker(ctx context.Context, hub *Hub, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			hub.CapturePanicWithHint(r, &EventHint{Context: ctx})
+			err = &PanicError{Value: r}
+		}
+	}()
+
+	err = f(ctx)
+	if err != nil && (ctx.Err() == nil || !errors.Is(err, ctx.Err())) {
+		hub.CaptureExceptionWithHint(err, &EventHint{Context: ctx})
+	}
+	return err
+}
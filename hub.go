@@ -0,0 +1,231 @@
+package statly
+
+import (
+	"sync"
+	"time"
+)
+
+// layer pairs a client with the scope that is active on a hub.
+type layer struct {
+	client *Client
+	scope  *Scope
+}
+
+// Hub manages a client and a stack of scopes.
+//
+// Each goroutine or request that needs isolated context should work on its
+// own hub, typically obtained by cloning the current hub with Clone.
+type Hub struct {
+	mu    sync.RWMutex
+	stack []*layer
+}
+
+// NewHub creates a new hub with the given client and scope.
+func NewHub(client *Client, scope *Scope) *Hub {
+	if scope == nil {
+		scope = NewScope()
+	}
+	return &Hub{
+		stack: []*layer{{client: client, scope: scope}},
+	}
+}
+
+// top returns the layer on top of the stack.
+func (h *Hub) top() *layer {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.stack[len(h.stack)-1]
+}
+
+// Client returns the client bound to the hub.
+func (h *Hub) Client() *Client {
+	return h.top().client
+}
+
+// Scope returns the scope on top of the stack.
+func (h *Hub) Scope() *Scope {
+	return h.top().scope
+}
+
+// BindClient binds a new client to the current scope of the hub.
+func (h *Hub) BindClient(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stack[len(h.stack)-1].client = client
+}
+
+// PushScope pushes a clone of the current scope onto the stack and returns it.
+func (h *Hub) PushScope() *Scope {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	top := h.stack[len(h.stack)-1]
+	scope := top.scope.Clone()
+	scope.hub = h
+	h.stack = append(h.stack, &layer{client: top.client, scope: scope})
+
+	return scope
+}
+
+// PopScope removes the scope on top of the stack.
+// The root scope is never removed.
+func (h *Hub) PopScope() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.stack) > 1 {
+		h.stack[len(h.stack)-1] = nil
+		h.stack = h.stack[:len(h.stack)-1]
+	}
+}
+
+// WithScope pushes a copy of the current scope for the duration of f and
+// removes it when f returns, even if f panics. Events captured on the hub
+// inside f carry the data set on the scope. Goroutines sharing the hub see
+// the scope too; events captured with the scope's capture methods carry only
+// its own data.
+func (h *Hub) WithScope(f func(*Scope)) {
+	scope := h.PushScope()
+	defer h.removeScope(scope)
+
+	f(scope)
+}
+
+// removeScope removes a scope pushed with PushScope. Unlike PopScope, it
+// removes the given scope even if other scopes were pushed on top of it
+// since. The root scope is never removed.
+func (h *Hub) removeScope(scope *Scope) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := len(h.stack) - 1; i > 0; i-- {
+		if h.stack[i].scope == scope {
+			h.stack = append(h.stack[:i], h.stack[i+1:]...)
+			return
+		}
+	}
+}
+
+// Clone creates a new hub with the same client and a copy of the current scope.
+func (h *Hub) Clone() *Hub {
+	top := h.top()
+	return NewHub(top.client, top.scope.Clone())
+}
+
+// CaptureException captures an error using the hub's current scope.
+func (h *Hub) CaptureException(err error) string {
+	return h.captureException(err, nil, nil)
+}
+
+// CaptureExceptionWithContext captures an error with additional context using
+// the hub's current scope.
+func (h *Hub) CaptureExceptionWithContext(err error, ctx map[string]interface{}) string {
+	return h.captureException(err, ctx, nil)
+}
+
+// CaptureExceptionWithHint captures an error using the hub's current scope and
+// passes the hint to event processors and BeforeSend.
+func (h *Hub) CaptureExceptionWithHint(err error, hint *EventHint) string {
+	return h.captureException(err, nil, hint)
+}
+
+// captureException captures an error with the bound client and current scope.
+func (h *Hub) captureException(err error, ctx map[string]interface{}, hint *EventHint) string {
+	top := h.top()
+	if top.client == nil {
+		return ""
+	}
+	return top.client.captureException(err, ctx, hint, top.scope)
+}
+
+// CapturePanic captures a value recovered from a panic using the hub's current
+// scope. Call it from the deferred function that recovered the panic so the
+// stack of the panicking goroutine is recorded.
+func (h *Hub) CapturePanic(r interface{}) string {
+	return h.capturePanic(r, nil, nil)
+}
+
+// CapturePanicWithHint captures a value recovered from a panic using the hub's
+// current scope and passes the hint to event processors and BeforeSend.
+func (h *Hub) CapturePanicWithHint(r interface{}, hint *EventHint) string {
+	return h.capturePanic(r, nil, hint)
+}
+
+// capturePanic captures a recovered panic with the bound client and current
+// scope.
+func (h *Hub) capturePanic(r interface{}, ctx map[string]interface{}, hint *EventHint) string {
+	top := h.top()
+	if top.client == nil {
+		return ""
+	}
+	return top.client.capturePanic(r, ctx, hint, top.scope)
+}
+
+// CaptureMessage captures a message using the hub's current scope.
+func (h *Hub) CaptureMessage(message string, level Level) string {
+	return h.captureMessage(message, level, nil, nil)
+}
+
+// CaptureMessageWithContext captures a message with additional context using
+// the hub's current scope.
+func (h *Hub) CaptureMessageWithContext(message string, level Level, ctx map[string]interface{}) string {
+	return h.captureMessage(message, level, ctx, nil)
+}
+
+// CaptureMessageWithHint captures a message using the hub's current scope and
+// passes the hint to event processors and BeforeSend.
+func (h *Hub) CaptureMessageWithHint(message string, level Level, hint *EventHint) string {
+	return h.captureMessage(message, level, nil, hint)
+}
+
+// captureMessage captures a message with the bound client and current scope.
+func (h *Hub) captureMessage(message string, level Level, ctx map[string]interface{}, hint *EventHint) string {
+	top := h.top()
+	if top.client == nil {
+		return ""
+	}
+	return top.client.captureMessage(message, level, ctx, hint, top.scope)
+}
+
+// SetUser sets the user on the current scope.
+func (h *Hub) SetUser(user User) {
+	h.Scope().SetUser(user)
+}
+
+// SetTag sets a tag on the current scope.
+func (h *Hub) SetTag(key, value string) {
+	h.Scope().SetTag(key, value)
+}
+
+// SetTags sets multiple tags on the current scope.
+func (h *Hub) SetTags(tags map[string]string) {
+	h.Scope().SetTags(tags)
+}
+
+// SetExtra sets extra data on the current scope.
+func (h *Hub) SetExtra(key string, value interface{}) {
+	h.Scope().SetExtra(key, value)
+}
+
+// AddBreadcrumb adds a breadcrumb to the current scope.
+func (h *Hub) AddBreadcrumb(crumb Breadcrumb) {
+	h.Scope().AddBreadcrumb(crumb)
+}
+
+// Flush flushes pending events of the bound client and reports whether every
+// event was delivered.
+func (h *Hub) Flush() bool {
+	if client := h.Client(); client != nil {
+		return client.Flush()
+	}
+	return false
+}
+
+// FlushWithTimeout flushes pending events of the bound client and reports
+// whether every event was delivered within the timeout.
+func (h *Hub) FlushWithTimeout(timeout time.Duration) bool {
+	if client := h.Client(); client != nil {
+		return client.FlushWithTimeout(timeout)
+	}
+	return false
+}
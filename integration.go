@@ -0,0 +1,202 @@
+package statly
+
+import (
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// Integration is a pluggable feature that is installed on a client.
+type Integration interface {
+	// Name returns the unique name of the integration.
+	Name() string
+
+	// SetupOnce installs the integration on the client. It is called at most
+	// once per client.
+	SetupOnce(client *Client)
+}
+
+// Names of the built-in integrations.
+const (
+	RuntimeIntegrationName     = "Runtime"
+	ModulesIntegrationName     = "Modules"
+	EnvironmentIntegrationName = "Environment"
+	DedupeIntegrationName      = "Dedupe"
+)
+
+// DefaultIntegrations returns the integrations installed when
+// Options.Integrations is not set.
+func DefaultIntegrations() []Integration {
+	return []Integration{
+		&runtimeIntegration{},
+		&modulesIntegration{},
+		&environmentIntegration{},
+		&dedupeIntegration{},
+	}
+}
+
+// WithoutIntegrations returns a function for Options.Integrations that removes
+// the named integrations from the defaults.
+func WithoutIntegrations(names ...string) func([]Integration) []Integration {
+	return func(integrations []Integration) []Integration {
+		filtered := make([]Integration, 0, len(integrations))
+	outer:
+		for _, integration := range integrations {
+			for _, name := range names {
+				if integration.Name() == name {
+					continue outer
+				}
+			}
+			filtered = append(filtered, integration)
+		}
+		return filtered
+	}
+}
+
+// setupIntegrations installs the configured integrations on the client.
+func (c *Client) setupIntegrations() {
+	integrations := DefaultIntegrations()
+	if c.options.SourceContext {
+		integrations = append(integrations, newSourceContextIntegration(c.options.SourceContextLines))
+	}
+	if c.options.Integrations != nil {
+		integrations = c.options.Integrations(integrations)
+	}
+
+	c.integrations = make(map[string]Integration, len(integrations))
+	for _, integration := range integrations {
+		if integration == nil {
+			continue
+		}
+		if _, ok := c.integrations[integration.Name()]; ok {
+			continue
+		}
+		c.integrations[integration.Name()] = integration
+		integration.SetupOnce(c)
+	}
+}
+
+// Integration returns the installed integration with the given name, or nil.
+func (c *Client) Integration(name string) Integration {
+	return c.integrations[name]
+}
+
+// runtimeIntegration attaches Go runtime information to events.
+type runtimeIntegration struct{}
+
+func (ri *runtimeIntegration) Name() string {
+	return RuntimeIntegrationName
+}
+
+func (ri *runtimeIntegration) SetupOnce(client *Client) {
+	client.AddEventProcessor(func(event *Event, hint *EventHint) *Event {
+		if _, ok := event.Contexts["runtime"]; !ok {
+			event.Contexts["runtime"] = getRuntimeInfo()
+		}
+		return event
+	})
+}
+
+// modulesIntegration attaches the versions of the modules the binary was
+// built with.
+type modulesIntegration struct {
+	once    sync.Once
+	modules map[string]string
+}
+
+func (mi *modulesIntegration) Name() string {
+	return ModulesIntegrationName
+}
+
+func (mi *modulesIntegration) SetupOnce(client *Client) {
+	client.AddEventProcessor(func(event *Event, hint *EventHint) *Event {
+		mi.once.Do(func() {
+			mi.modules = getModules()
+		})
+		// Each event gets its own copy, so changes made to one event do not
+		// show up in later ones
+		if len(mi.modules) > 0 && event.Modules == nil {
+			event.Modules = copyStrings(mi.modules)
+		}
+		return event
+	})
+}
+
+// getModules returns the main module and dependency versions from the build info.
+func getModules() map[string]string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+
+	modules := make(map[string]string, len(info.Deps)+1)
+	if info.Main.Path != "" {
+		modules[info.Main.Path] = info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		modules[dep.Path] = dep.Version
+	}
+	return modules
+}
+
+// environmentIntegration fills in the environment and release from the
+// process environment when they are not configured.
+type environmentIntegration struct {
+	environment string
+	release     string
+}
+
+func (ei *environmentIntegration) Name() string {
+	return EnvironmentIntegrationName
+}
+
+func (ei *environmentIntegration) SetupOnce(client *Client) {
+	ei.environment = os.Getenv("STATLY_ENVIRONMENT")
+	ei.release = os.Getenv("STATLY_RELEASE")
+	if ei.release == "" {
+		ei.release = getVCSRevision()
+	}
+
+	client.AddEventProcessor(func(event *Event, hint *EventHint) *Event {
+		if event.Environment == "" {
+			event.Environment = ei.environment
+		}
+		if event.Release == "" {
+			event.Release = ei.release
+		}
+		return event
+	})
+}
+
+// dedupeIntegration suppresses repeated exception events. Duplicates are
+// detected after BeforeSend and trimming, once the event that would be sent
+// is final, so the check runs in the client's send path rather than as an
+// event processor.
+type dedupeIntegration struct{}
+
+func (di *dedupeIntegration) Name() string {
+	return DedupeIntegrationName
+}
+
+func (di *dedupeIntegration) SetupOnce(client *Client) {
+	if client.options.DedupeWindow > 0 {
+		client.deduper = newDeduper(client.options.DedupeWindow)
+	}
+}
+
+// getVCSRevision returns the VCS revision the binary was built from, if any.
+func getVCSRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
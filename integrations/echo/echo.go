@@ -35,13 +35,15 @@ func DefaultOptions() Options {
 func Recovery(options Options) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			hub := GetHubFromContext(c)
+
 			defer func() {
 				if r := recover(); r != nil {
 					// Build request info
 					requestInfo := extractRequestInfo(c)
 
 					// Add breadcrumb
-					statly.AddBreadcrumb(statly.Breadcrumb{
+					hub.AddBreadcrumb(statly.Breadcrumb{
 						Message:  fmt.Sprintf("%s %s", c.Request().Method, c.Request().URL.Path),
 						Category: "http",
 						Level:    statly.LevelInfo,
@@ -52,9 +54,10 @@ func Recovery(options Options) echo.MiddlewareFunc {
 					})
 
 					// Set tags
-					statly.SetTag("http.method", c.Request().Method)
-					statly.SetTag("http.url", c.Request().URL.Path)
-					statly.SetTag("transaction", c.Path())
+					hub.SetTag("http.method", c.Request().Method)
+					hub.SetTag("http.url", c.Request().URL.Path)
+					hub.SetTag("transaction", c.Path())
+					hub.Scope().SetTransaction(c.Path())
 
 					// Convert panic to error
 					var captureErr error
@@ -68,12 +71,15 @@ func Recovery(options Options) echo.MiddlewareFunc {
 					}
 
 					// Capture with context
-					statly.CaptureExceptionWithContext(captureErr, map[string]interface{}{
-						"request": requestInfo,
+					hub.SetExtra("request", requestInfo)
+					hub.CapturePanicWithHint(r, &statly.EventHint{
+						Mechanism: statly.MechanismHTTPServer,
+						Request:   c.Request(),
+						Context:   c.Request().Context(),
 					})
 
 					if options.WaitForDelivery {
-						statly.Flush()
+						hub.FlushWithTimeout(options.Timeout)
 					}
 
 					if options.Repanic {
@@ -94,9 +100,10 @@ func Logger() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			start := time.Now()
+			hub := GetHubFromContext(c)
 
 			// Add request breadcrumb
-			statly.AddBreadcrumb(statly.Breadcrumb{
+			hub.AddBreadcrumb(statly.Breadcrumb{
 				Message:  fmt.Sprintf("%s %s", c.Request().Method, c.Request().URL.Path),
 				Category: "http",
 				Level:    statly.LevelInfo,
@@ -115,7 +122,7 @@ func Logger() echo.MiddlewareFunc {
 				level = statly.LevelError
 			}
 
-			statly.AddBreadcrumb(statly.Breadcrumb{
+			hub.AddBreadcrumb(statly.Breadcrumb{
 				Message:  fmt.Sprintf("Response %d", c.Response().Status),
 				Category: "http",
 				Level:    level,
@@ -134,14 +141,17 @@ func Logger() echo.MiddlewareFunc {
 func ErrorHandler(defaultHandler echo.HTTPErrorHandler) echo.HTTPErrorHandler {
 	return func(err error, c echo.Context) {
 		requestInfo := extractRequestInfo(c)
+		hub := GetHubFromContext(c)
 
 		// Set tags
-		statly.SetTag("http.method", c.Request().Method)
-		statly.SetTag("http.url", c.Request().URL.Path)
+		hub.SetTag("http.method", c.Request().Method)
+		hub.SetTag("http.url", c.Request().URL.Path)
 
 		// Capture the error
-		statly.CaptureExceptionWithContext(err, map[string]interface{}{
-			"request": requestInfo,
+		hub.SetExtra("request", requestInfo)
+		hub.CaptureExceptionWithHint(err, &statly.EventHint{
+			Request: c.Request(),
+			Context: c.Request().Context(),
 		})
 
 		// Call default handler
@@ -151,6 +161,19 @@ func ErrorHandler(defaultHandler echo.HTTPErrorHandler) echo.HTTPErrorHandler {
 	}
 }
 
+// GetHubFromContext returns the hub attached to the request. When there is
+// none, the current hub is cloned and installed on the request context.
+func GetHubFromContext(c echo.Context) *statly.Hub {
+	r := c.Request()
+	if hub := statly.GetHubFromContext(r.Context()); hub != nil {
+		return hub
+	}
+
+	hub := statly.CurrentHub().Clone()
+	c.SetRequest(r.WithContext(statly.SetHubOnContext(r.Context(), hub)))
+	return hub
+}
+
 // extractRequestInfo extracts request information from an Echo context.
 func extractRequestInfo(c echo.Context) map[string]interface{} {
 	r := c.Request()
@@ -199,5 +222,5 @@ func extractRequestInfo(c echo.Context) map[string]interface{} {
 
 // SetUserFromContext is a helper to set user context.
 func SetUserFromContext(c echo.Context, user statly.User) {
-	statly.SetUser(user)
+	GetHubFromContext(c).SetUser(user)
 }
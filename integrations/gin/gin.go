@@ -35,13 +35,15 @@ func DefaultOptions() Options {
 // Recovery returns a Gin middleware that recovers from panics.
 func Recovery(options Options) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		hub := GetHubFromContext(c)
+
 		defer func() {
 			if err := recover(); err != nil {
 				// Build request info
 				requestInfo := extractRequestInfo(c)
 
 				// Add breadcrumb
-				statly.AddBreadcrumb(statly.Breadcrumb{
+				hub.AddBreadcrumb(statly.Breadcrumb{
 					Message:  fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path),
 					Category: "http",
 					Level:    statly.LevelInfo,
@@ -52,9 +54,10 @@ func Recovery(options Options) gin.HandlerFunc {
 				})
 
 				// Set tags
-				statly.SetTag("http.method", c.Request.Method)
-				statly.SetTag("http.url", c.Request.URL.Path)
-				statly.SetTag("transaction", c.FullPath())
+				hub.SetTag("http.method", c.Request.Method)
+				hub.SetTag("http.url", c.Request.URL.Path)
+				hub.SetTag("transaction", c.FullPath())
+				hub.Scope().SetTransaction(c.FullPath())
 
 				// Convert panic to error
 				var captureErr error
@@ -68,12 +71,15 @@ func Recovery(options Options) gin.HandlerFunc {
 				}
 
 				// Capture with context
-				statly.CaptureExceptionWithContext(captureErr, map[string]interface{}{
-					"request": requestInfo,
+				hub.SetExtra("request", requestInfo)
+				hub.CapturePanicWithHint(err, &statly.EventHint{
+					Mechanism: statly.MechanismHTTPServer,
+					Request:   c.Request,
+					Context:   c.Request.Context(),
 				})
 
 				if options.WaitForDelivery {
-					statly.Flush()
+					hub.FlushWithTimeout(options.Timeout)
 				}
 
 				// Set error on context
@@ -96,9 +102,10 @@ func Recovery(options Options) gin.HandlerFunc {
 func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
+		hub := GetHubFromContext(c)
 
 		// Add request breadcrumb
-		statly.AddBreadcrumb(statly.Breadcrumb{
+		hub.AddBreadcrumb(statly.Breadcrumb{
 			Message:  fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path),
 			Category: "http",
 			Level:    statly.LevelInfo,
@@ -117,7 +124,7 @@ func Logger() gin.HandlerFunc {
 			level = statly.LevelError
 		}
 
-		statly.AddBreadcrumb(statly.Breadcrumb{
+		hub.AddBreadcrumb(statly.Breadcrumb{
 			Message:  fmt.Sprintf("Response %d", c.Writer.Status()),
 			Category: "http",
 			Level:    level,
@@ -132,6 +139,8 @@ func Logger() gin.HandlerFunc {
 // ErrorHandler returns middleware that captures errors from c.Error().
 func ErrorHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		hub := GetHubFromContext(c)
+
 		c.Next()
 
 		// Check for errors
@@ -139,15 +148,31 @@ func ErrorHandler() gin.HandlerFunc {
 			requestInfo := extractRequestInfo(c)
 
 			for _, ginErr := range c.Errors {
-				statly.CaptureExceptionWithContext(ginErr.Err, map[string]interface{}{
-					"request": requestInfo,
-					"meta":    ginErr.Meta,
+				hub.WithScope(func(scope *statly.Scope) {
+					scope.SetExtra("request", requestInfo)
+					scope.SetExtra("meta", ginErr.Meta)
+					scope.CaptureExceptionWithHint(ginErr.Err, &statly.EventHint{
+						Request: c.Request,
+						Context: c.Request.Context(),
+					})
 				})
 			}
 		}
 	}
 }
 
+// GetHubFromContext returns the hub attached to the request. When there is
+// none, the current hub is cloned and installed on the request context.
+func GetHubFromContext(c *gin.Context) *statly.Hub {
+	if hub := statly.GetHubFromContext(c.Request.Context()); hub != nil {
+		return hub
+	}
+
+	hub := statly.CurrentHub().Clone()
+	c.Request = c.Request.WithContext(statly.SetHubOnContext(c.Request.Context(), hub))
+	return hub
+}
+
 // extractRequestInfo extracts request information from a Gin context.
 func extractRequestInfo(c *gin.Context) map[string]interface{} {
 	r := c.Request
@@ -195,5 +220,5 @@ func extractRequestInfo(c *gin.Context) map[string]interface{} {
 
 // SetUserFromContext is a helper to set user context.
 func SetUserFromContext(c *gin.Context, user statly.User) {
-	statly.SetUser(user)
+	GetHubFromContext(c).SetUser(user)
 }
@@ -0,0 +1,367 @@
+package statly
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+// Default event limits.
+const (
+	DefaultMaxStringLength = 8192
+	DefaultMaxBreadth      = 100
+	DefaultMaxDepth        = 10
+	DefaultMaxEventSize    = 1 << 20
+)
+
+// Reasons recorded for data trimmed from an event.
+const (
+	TrimReasonLength  = "max_length"
+	TrimReasonBreadth = "max_breadth"
+	TrimReasonDepth   = "max_depth"
+	TrimReasonCount   = "max_count"
+	TrimReasonSize    = "max_size"
+)
+
+// EventLimits bounds the size of events sent to Statly. Zero fields use the
+// defaults.
+type EventLimits struct {
+	// MaxStringLength is the maximum length in bytes of a string value.
+	MaxStringLength int
+
+	// MaxBreadth is the maximum number of entries kept per map or slice.
+	MaxBreadth int
+
+	// MaxDepth is the maximum nesting depth of maps and slices in extra
+	// data, contexts, breadcrumb data and request data.
+	MaxDepth int
+
+	// MaxEventSize is the maximum size in bytes of a serialized event. Larger
+	// events lose breadcrumbs, source context, extra data, contexts, request
+	// data and frames from the middle of their stack traces, in that order,
+	// until they fit. As a last resort, tags, modules, user and request are
+	// removed; events that still do not fit are dropped.
+	MaxEventSize int
+}
+
+// TrimmedValue describes data removed from an event to respect the limits.
+// Trimmed values are recorded in Event.Meta by the path of the value, e.g.
+// "extra.payload" or "breadcrumbs".
+type TrimmedValue struct {
+	// Reason is why the value was trimmed, e.g. TrimReasonLength.
+	Reason string `json:"reason"`
+
+	// Length is the original length of the value: bytes for strings,
+	// entries for maps, slices and breadcrumbs, and serialized bytes for
+	// values removed to fit the event size.
+	Length int `json:"len,omitempty"`
+}
+
+// trimmer applies event limits and records what was trimmed.
+type trimmer struct {
+	limits         EventLimits
+	maxBreadcrumbs int
+	meta           map[string]TrimmedValue
+
+	// visiting holds the pointers on the path to the value being normalized
+	visiting map[visit]bool
+}
+
+// trimEvent applies the limits to the event. Individual values are trimmed
+// first; if the event is still too large, the lowest-value data is removed.
+// Trimmed values are recorded in the event's Meta as they are removed, so the
+// size checks account for them. It reports whether the event fits the
+// maximum event size.
+func trimEvent(event *Event, limits EventLimits, maxBreadcrumbs int) bool {
+	if event.Meta == nil {
+		event.Meta = make(map[string]TrimmedValue)
+	}
+	t := &trimmer{
+		limits:         limits,
+		maxBreadcrumbs: maxBreadcrumbs,
+		meta:           event.Meta,
+		visiting:       make(map[visit]bool),
+	}
+
+	t.trimValues(event)
+	fits := t.fitSize(event)
+
+	if len(event.Meta) == 0 {
+		event.Meta = nil
+	}
+	return fits
+}
+
+// trimValues normalizes the free-form values of the event and caps its
+// strings, maps and slices.
+func (t *trimmer) trimValues(event *Event) {
+	event.Message = t.trimString("message", event.Message)
+	for i := range event.Exception {
+		event.Exception[i].Value = t.trimString(fmt.Sprintf("exception.%d.value", i), event.Exception[i].Value)
+	}
+
+	if len(event.Tags) > t.limits.MaxBreadth {
+		t.record("tags", TrimReasonBreadth, len(event.Tags))
+		keys := make([]string, 0, len(event.Tags))
+		for key := range event.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys[t.limits.MaxBreadth:] {
+			delete(event.Tags, key)
+		}
+	}
+	for key, value := range event.Tags {
+		event.Tags[key] = t.trimString("tags."+key, value)
+	}
+
+	if event.Extra != nil {
+		event.Extra = t.trimMap("extra", event.Extra)
+	}
+	if event.Contexts != nil {
+		event.Contexts = t.trimMap("contexts", event.Contexts)
+	}
+	if event.User != nil && event.User.Data != nil {
+		user := *event.User
+		user.Data = t.trimMap("user.data", user.Data)
+		event.User = &user
+	}
+
+	if t.maxBreadcrumbs > 0 && len(event.Breadcrumbs) > t.maxBreadcrumbs {
+		t.record("breadcrumbs", TrimReasonCount, len(event.Breadcrumbs))
+		event.Breadcrumbs = event.Breadcrumbs[len(event.Breadcrumbs)-t.maxBreadcrumbs:]
+	}
+	for i := range event.Breadcrumbs {
+		crumb := &event.Breadcrumbs[i]
+		path := fmt.Sprintf("breadcrumbs.%d", i)
+		crumb.Message = t.trimString(path+".message", crumb.Message)
+		if crumb.Data != nil {
+			crumb.Data = t.trimMap(path+".data", crumb.Data)
+		}
+	}
+
+	if event.Request != nil {
+		request := *event.Request
+		request.URL = t.trimString("request.url", request.URL)
+		request.QueryString = t.trimString("request.query_string", request.QueryString)
+		request.Cookies = t.trimString("request.cookies", request.Cookies)
+		if request.Data != nil {
+			request.Data = t.trimValue("request.data", request.Data, 1)
+		}
+		event.Request = &request
+	}
+}
+
+// trimMap returns a trimmed copy of a top-level map of the event.
+func (t *trimmer) trimMap(path string, m map[string]interface{}) map[string]interface{} {
+	trimmed, _ := t.trimValue(path, m, 0).(map[string]interface{})
+	if trimmed == nil {
+		trimmed = make(map[string]interface{})
+	}
+	return trimmed
+}
+
+// trimValue returns a normalized copy of v with strings, maps and slices
+// capped. See normalize.
+func (t *trimmer) trimValue(path string, v interface{}, depth int) interface{} {
+	return t.normalize(path, reflect.ValueOf(v), depth)
+}
+
+// trimString caps a string at the maximum length without splitting a UTF-8
+// sequence. Trimmed strings end in "...".
+func (t *trimmer) trimString(path, s string) string {
+	max := t.limits.MaxStringLength
+	if len(s) <= max {
+		return s
+	}
+	t.record(path, TrimReasonLength, len(s))
+
+	n := max - len("...")
+	if n < 0 {
+		n = 0
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
+
+// fitSize removes the lowest-value data until the serialized event fits the
+// maximum event size. It reports whether the event fits.
+func (t *trimmer) fitSize(event *Event) bool {
+	if t.fits(event) {
+		return true
+	}
+
+	// Drop the oldest breadcrumbs first
+	if count := len(event.Breadcrumbs); count > 0 {
+		for len(event.Breadcrumbs) > 0 && !t.fits(event) {
+			event.Breadcrumbs = event.Breadcrumbs[(len(event.Breadcrumbs)+1)/2:]
+		}
+		if len(event.Breadcrumbs) < count {
+			t.record("breadcrumbs", TrimReasonSize, count)
+		}
+		if t.fits(event) {
+			return true
+		}
+	}
+
+	// Then source context and frame variables
+	removed := false
+	for _, exc := range event.Exception {
+		if exc.Stacktrace == nil {
+			continue
+		}
+		for i := range exc.Stacktrace.Frames {
+			frame := &exc.Stacktrace.Frames[i]
+			if frame.ContextLine != "" || frame.PreContext != nil || frame.PostContext != nil || frame.Vars != nil {
+				frame.ContextLine, frame.PreContext, frame.PostContext, frame.Vars = "", nil, nil, nil
+				removed = true
+			}
+		}
+	}
+	if removed {
+		t.record("exception.stacktrace.context", TrimReasonSize, 0)
+		if t.fits(event) {
+			return true
+		}
+	}
+
+	// Then the largest extra values, contexts and request data
+	t.removeLargest("extra", event.Extra, eventSize(event))
+	if t.fits(event) {
+		return true
+	}
+	t.removeLargest("contexts", event.Contexts, eventSize(event))
+	if t.fits(event) {
+		return true
+	}
+	if event.Request != nil && event.Request.Data != nil {
+		t.record("request.data", TrimReasonSize, valueSize(event.Request.Data))
+		event.Request.Data = nil
+		if t.fits(event) {
+			return true
+		}
+	}
+
+	// Then frames from the middle of the stack traces
+	if t.removeFrames(event) {
+		return true
+	}
+
+	// As a last resort, drop the remaining optional data
+	if len(event.Tags) > 0 {
+		t.record("tags", TrimReasonSize, len(event.Tags))
+		event.Tags = nil
+	}
+	if len(event.Modules) > 0 {
+		t.record("modules", TrimReasonSize, len(event.Modules))
+		event.Modules = nil
+	}
+	if event.User != nil {
+		t.record("user", TrimReasonSize, valueSize(event.User))
+		event.User = nil
+	}
+	if event.Request != nil {
+		t.record("request", TrimReasonSize, valueSize(event.Request))
+		event.Request = nil
+	}
+	return t.fits(event)
+}
+
+// removeFrames halves the frames of the stack traces of the event, removing
+// them from the middle, until the event fits or no frames are left. It
+// reports whether the event fits.
+func (t *trimmer) removeFrames(event *Event) bool {
+	for i, exc := range event.Exception {
+		st := exc.Stacktrace
+		if st == nil || len(st.Frames) == 0 {
+			continue
+		}
+		count := len(st.Frames)
+		if len(st.FramesOmitted) == 2 {
+			count += st.FramesOmitted[1] - st.FramesOmitted[0]
+		}
+		t.record(fmt.Sprintf("exception.%d.stacktrace.frames", i), TrimReasonSize, count)
+	}
+
+	for {
+		removed := false
+		for _, exc := range event.Exception {
+			if st := exc.Stacktrace; st != nil && len(st.Frames) > 0 {
+				omitFrames(st, len(st.Frames)/2)
+				removed = true
+			}
+		}
+		if !removed {
+			return false
+		}
+		if t.fits(event) {
+			return true
+		}
+	}
+}
+
+// fits reports whether the serialized event, including its recorded trimmed
+// values, fits the maximum event size.
+func (t *trimmer) fits(event *Event) bool {
+	return eventSize(event) <= t.limits.MaxEventSize
+}
+
+// removeLargest deletes the largest entries of m until the event size, which
+// starts at size, fits the maximum. It returns the new event size.
+func (t *trimmer) removeLargest(path string, m map[string]interface{}, size int) int {
+	type entry struct {
+		key  string
+		size int
+	}
+
+	entries := make([]entry, 0, len(m))
+	for key, value := range m {
+		entries = append(entries, entry{key, valueSize(value)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].size != entries[j].size {
+			return entries[i].size > entries[j].size
+		}
+		return entries[i].key < entries[j].key
+	})
+
+	for _, e := range entries {
+		if size <= t.limits.MaxEventSize {
+			break
+		}
+		delete(m, e.key)
+		t.record(path+"."+e.key, TrimReasonSize, e.size)
+		size -= e.size
+	}
+
+	return size
+}
+
+// record notes that the value at path was trimmed.
+func (t *trimmer) record(path, reason string, length int) {
+	t.meta[path] = TrimmedValue{Reason: reason, Length: length}
+}
+
+// eventSize returns the size of the serialized event, or 0 if it cannot be
+// serialized.
+func eventSize(event *Event) int {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// valueSize returns the size of a serialized value, or 0 if it cannot be
+// serialized.
+func valueSize(v interface{}) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
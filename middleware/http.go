@@ -4,7 +4,6 @@ package middleware
 import (
 	"fmt"
 	"net/http"
-	"runtime/debug"
 	"strings"
 	"time"
 
@@ -36,13 +35,15 @@ func DefaultOptions() Options {
 func Recovery(options Options) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hub, r := requestHub(r)
+
 			defer func() {
 				if err := recover(); err != nil {
 					// Build request info
 					requestInfo := extractRequestInfo(r)
 
 					// Add breadcrumb
-					statly.AddBreadcrumb(statly.Breadcrumb{
+					hub.AddBreadcrumb(statly.Breadcrumb{
 						Message:  fmt.Sprintf("%s %s", r.Method, r.URL.Path),
 						Category: "http",
 						Level:    statly.LevelInfo,
@@ -53,28 +54,19 @@ func Recovery(options Options) func(http.Handler) http.Handler {
 					})
 
 					// Set tags
-					statly.SetTag("http.method", r.Method)
-					statly.SetTag("http.url", r.URL.Path)
-
-					// Convert panic to error
-					var captureErr error
-					switch v := err.(type) {
-					case error:
-						captureErr = v
-					case string:
-						captureErr = fmt.Errorf("%s", v)
-					default:
-						captureErr = fmt.Errorf("%v", v)
-					}
+					hub.SetTag("http.method", r.Method)
+					hub.SetTag("http.url", r.URL.Path)
 
 					// Capture with context
-					statly.CaptureExceptionWithContext(captureErr, map[string]interface{}{
-						"request":    requestInfo,
-						"stacktrace": string(debug.Stack()),
+					hub.SetExtra("request", requestInfo)
+					hub.CapturePanicWithHint(err, &statly.EventHint{
+						Mechanism: statly.MechanismHTTPServer,
+						Request:   r,
+						Context:   r.Context(),
 					})
 
 					if options.WaitForDelivery {
-						statly.Flush()
+						hub.FlushWithTimeout(options.Timeout)
 					}
 
 					// Write error response
@@ -96,9 +88,10 @@ func RequestLogger() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			hub, r := requestHub(r)
 
 			// Add request breadcrumb
-			statly.AddBreadcrumb(statly.Breadcrumb{
+			hub.AddBreadcrumb(statly.Breadcrumb{
 				Message:  fmt.Sprintf("%s %s", r.Method, r.URL.Path),
 				Category: "http",
 				Level:    statly.LevelInfo,
@@ -120,7 +113,7 @@ func RequestLogger() func(http.Handler) http.Handler {
 				level = statly.LevelError
 			}
 
-			statly.AddBreadcrumb(statly.Breadcrumb{
+			hub.AddBreadcrumb(statly.Breadcrumb{
 				Message:  fmt.Sprintf("Response %d", wrapped.statusCode),
 				Category: "http",
 				Level:    level,
@@ -133,6 +126,17 @@ func RequestLogger() func(http.Handler) http.Handler {
 	}
 }
 
+// requestHub returns the hub stored on the request context. When there is
+// none, the current hub is cloned and installed on a copy of the request.
+func requestHub(r *http.Request) (*statly.Hub, *http.Request) {
+	if hub := statly.GetHubFromContext(r.Context()); hub != nil {
+		return hub, r
+	}
+
+	hub := statly.CurrentHub().Clone()
+	return hub, r.WithContext(statly.SetHubOnContext(r.Context(), hub))
+}
+
 // responseWriter wraps http.ResponseWriter to capture the status code.
 type responseWriter struct {
 	http.ResponseWriter
@@ -193,7 +197,7 @@ func extractRequestInfo(r *http.Request) map[string]interface{} {
 func SetUserFromRequest(r *http.Request, getUserFunc func(*http.Request) *statly.User) {
 	if getUserFunc != nil {
 		if user := getUserFunc(r); user != nil {
-			statly.SetUser(*user)
+			statly.SetUserCtx(r.Context(), *user)
 		}
 	}
 }
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KodyDennon/statly-go"
+)
+
+// recordingTransport stores the events sent through it.
+type recordingTransport struct {
+	mu     sync.Mutex
+	events []*statly.Event
+}
+
+func (t *recordingTransport) Send(event *statly.Event) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+	return true
+}
+
+func (t *recordingTransport) Flush(timeout time.Duration) bool { return true }
+
+func (t *recordingTransport) Close(timeout time.Duration) {}
+
+func (t *recordingTransport) Events() []*statly.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*statly.Event(nil), t.events...)
+}
+
+func TestRecoveryIsolatesRequests(t *testing.T) {
+	transport := &recordingTransport{}
+	err := statly.Init(statly.Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	defer statly.Close()
+
+	const requests = 10
+	var ready sync.WaitGroup
+	ready.Add(requests)
+
+	handler := Recovery(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		statly.SetTagCtx(r.Context(), "request", id)
+		statly.SetUserCtx(r.Context(), statly.User{ID: id})
+
+		// Every request sets its scope before any of them captures
+		ready.Done()
+		ready.Wait()
+		panic("request " + id)
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?id="+id, nil))
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	events := transport.Events()
+	if len(events) != requests {
+		t.Fatalf("Expected %d events, got %d", requests, len(events))
+	}
+
+	seen := make(map[string]bool)
+	for _, event := range events {
+		id := event.Tags["request"]
+		if len(event.Exception) == 0 || event.Exception[0].Value != "request "+id {
+			t.Errorf("Expected the tags of the panicking request %q, got %+v", id, event.Exception)
+		}
+		if event.User == nil || event.User.ID != id {
+			t.Errorf("Expected the user of request %q, got %+v", id, event.User)
+		}
+		seen[id] = true
+	}
+	if len(seen) != requests {
+		t.Errorf("Expected the tags of %d distinct requests, got %v", requests, seen)
+	}
+}
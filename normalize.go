@@ -0,0 +1,276 @@
+package statly
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// visit identifies a pointer being normalized. The type is part of the key
+// because a struct and its first field share an address.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// normalize converts a value to one that always serializes to JSON while
+// applying the limits:
+//
+//   - json.Marshaler values are marshaled and decoded, so their output is
+//     limited like any other value
+//   - errors and fmt.Stringer values become their string
+//   - structs become maps of their exported fields, named by their json tags
+//   - channels, functions and unsafe pointers become a description of their
+//     type, and NaN and infinite floats become strings
+//   - cyclic references are replaced by a description
+//
+// Failing or panicking methods of foreign types are described rather than
+// propagated.
+func (t *trimmer) normalize(path string, rv reflect.Value, depth int) interface{} {
+	if !rv.IsValid() {
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+
+	// Break cycles through pointers, maps and slices
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		key := visit{rv.Pointer(), rv.Type()}
+		if t.visiting[key] {
+			return fmt.Sprintf("<cycle %s>", rv.Type())
+		}
+		t.visiting[key] = true
+		defer delete(t.visiting, key)
+	}
+
+	if rv.Kind() != reflect.Interface && rv.CanInterface() {
+		switch v := rv.Interface().(type) {
+		case json.Marshaler:
+			return t.normalizeMarshaler(path, v, depth)
+		case error:
+			return t.trimString(path, safeString(v, v.Error))
+		case fmt.Stringer:
+			return t.trimString(path, safeString(v, v.String))
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return t.normalize(path, rv.Elem(), depth)
+
+	case reflect.Bool:
+		return rv.Bool()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint()
+
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return f
+
+	case reflect.Complex64, reflect.Complex128:
+		return fmt.Sprint(rv.Complex())
+
+	case reflect.String:
+		return t.trimString(path, rv.String())
+
+	case reflect.Map:
+		return t.normalizeMap(path, rv, depth)
+
+	case reflect.Struct:
+		return t.normalizeStruct(path, rv, depth)
+
+	case reflect.Slice, reflect.Array:
+		return t.normalizeSlice(path, rv, depth)
+	}
+
+	// Channels, functions and unsafe pointers
+	return fmt.Sprintf("<%s>", rv.Type())
+}
+
+// normalizeMap converts a map to a map with string keys, keeping the entries
+// with the lowest keys when the map is too broad.
+func (t *trimmer) normalizeMap(path string, rv reflect.Value, depth int) interface{} {
+	if depth >= t.limits.MaxDepth {
+		t.record(path, TrimReasonDepth, rv.Len())
+		return nil
+	}
+
+	keys := make([]string, 0, rv.Len())
+	values := make(map[string]reflect.Value, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key := iter.Key()
+		name := fmt.Sprint(key.Interface())
+		if key.Kind() == reflect.String {
+			name = key.String()
+		}
+		keys = append(keys, name)
+		values[name] = iter.Value()
+	}
+	sort.Strings(keys)
+
+	if len(keys) > t.limits.MaxBreadth {
+		t.record(path, TrimReasonBreadth, len(keys))
+		keys = keys[:t.limits.MaxBreadth]
+	}
+
+	out := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		out[key] = t.normalize(path+"."+key, values[key], depth+1)
+	}
+	return out
+}
+
+// normalizeStruct converts a struct to a map of its exported fields named as
+// encoding/json would name them. Fields of embedded structs are promoted.
+func (t *trimmer) normalizeStruct(path string, rv reflect.Value, depth int) interface{} {
+	if depth >= t.limits.MaxDepth {
+		t.record(path, TrimReasonDepth, rv.NumField())
+		return nil
+	}
+
+	out := make(map[string]interface{})
+	t.addStructFields(path, rv, depth, out)
+
+	if len(out) > t.limits.MaxBreadth {
+		t.record(path, TrimReasonBreadth, len(out))
+		keys := make([]string, 0, len(out))
+		for key := range out {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys[t.limits.MaxBreadth:] {
+			delete(out, key)
+		}
+	}
+
+	return out
+}
+
+// addStructFields adds the exported fields of a struct to out.
+func (t *trimmer) addStructFields(path string, rv reflect.Value, depth int, out map[string]interface{}) {
+	typ := rv.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		value := rv.Field(i)
+
+		// Promote the fields of untagged embedded structs
+		if field.Anonymous && name == "" {
+			embedded := value
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				t.addStructFields(path, embedded, depth, out)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(options, "omitempty") && value.IsZero() {
+			continue
+		}
+		if _, ok := out[name]; ok {
+			continue
+		}
+
+		out[name] = t.normalize(path+"."+name, value, depth+1)
+	}
+}
+
+// normalizeSlice converts a slice or array to a slice, keeping the first
+// elements when it is too long. Byte slices are kept as they are.
+func (t *trimmer) normalizeSlice(path string, rv reflect.Value, depth int) interface{} {
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+		if rv.Len() > t.limits.MaxStringLength {
+			t.record(path, TrimReasonLength, rv.Len())
+			return rv.Slice(0, t.limits.MaxStringLength).Bytes()
+		}
+		return rv.Bytes()
+	}
+
+	if depth >= t.limits.MaxDepth {
+		t.record(path, TrimReasonDepth, rv.Len())
+		return nil
+	}
+
+	n := rv.Len()
+	if n > t.limits.MaxBreadth {
+		t.record(path, TrimReasonBreadth, n)
+		n = t.limits.MaxBreadth
+	}
+
+	out := make([]interface{}, n)
+	for i := range out {
+		out[i] = t.normalize(fmt.Sprintf("%s.%d", path, i), rv.Index(i), depth+1)
+	}
+	return out
+}
+
+// normalizeMarshaler marshals a value with its own MarshalJSON method and
+// decodes the result so it can be limited.
+func (t *trimmer) normalizeMarshaler(path string, m json.Marshaler, depth int) interface{} {
+	data, err := safeMarshal(m)
+	if err != nil {
+		return fmt.Sprintf("<%T: %v>", m, err)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Sprintf("<%T: %v>", m, err)
+	}
+
+	return t.normalize(path, reflect.ValueOf(v), depth)
+}
+
+// safeMarshal marshals a value, turning a panic into an error.
+func safeMarshal(v interface{}) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return json.Marshal(v)
+}
+
+// safeString calls a method returning a string, describing a panic instead
+// of propagating it.
+func safeString(v interface{}, method func() string) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			s = fmt.Sprintf("<%T: panic: %v>", v, r)
+		}
+	}()
+	return method()
+}
@@ -0,0 +1,58 @@
+package statly
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// EventHint carries additional information about the event being processed.
+// It is passed to event processors and BeforeSend but never sent to Statly.
+type EventHint struct {
+	// OriginalException is the error the event was created from.
+	OriginalException error
+
+	// RecoveredValue is the value passed to panic, for events created from a
+	// recovered panic.
+	RecoveredValue interface{}
+
+	// Mechanism is the mechanism type recorded for a recovered panic, e.g.
+	// MechanismHTTPServer. It defaults to MechanismPanic.
+	Mechanism string
+
+	// Request is the HTTP request being handled when the event was captured.
+	Request *http.Request
+
+	// Context is the context the event was captured with.
+	Context context.Context
+
+	// Data holds arbitrary values attached by the caller.
+	Data map[string]interface{}
+}
+
+// EventProcessor is a function that can modify or drop an event before it is
+// sent. Returning nil drops the event.
+type EventProcessor func(*Event, *EventHint) *Event
+
+var (
+	globalEventProcessors   []EventProcessor
+	globalEventProcessorsMu sync.RWMutex
+)
+
+// AddGlobalEventProcessor adds an event processor that runs for every event
+// captured by any client.
+func AddGlobalEventProcessor(processor EventProcessor) {
+	globalEventProcessorsMu.Lock()
+	defer globalEventProcessorsMu.Unlock()
+	globalEventProcessors = append(globalEventProcessors, processor)
+}
+
+// getGlobalEventProcessors returns a copy of the global event processors.
+func getGlobalEventProcessors() []EventProcessor {
+	globalEventProcessorsMu.RLock()
+	defer globalEventProcessorsMu.RUnlock()
+
+	processors := make([]EventProcessor, len(globalEventProcessors))
+	copy(processors, globalEventProcessors)
+	return processors
+}
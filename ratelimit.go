@@ -0,0 +1,154 @@
+package statly
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Category is a kind of data sent to Statly that is rate limited separately.
+type Category string
+
+// Rate limit categories.
+const (
+	CategoryError       Category = "error"
+	CategoryMessage     Category = "message"
+	CategoryTransaction Category = "transaction"
+	CategorySession     Category = "session"
+	CategoryCheckIn     Category = "check_in"
+	CategoryAttachment  Category = "attachment"
+
+	// categoryAll limits every category.
+	categoryAll Category = ""
+)
+
+// RateLimitsHeader is the response header carrying rate limits. It holds a
+// comma-separated list of limits in the form "<seconds>:<categories>", where
+// categories are separated by semicolons and an empty list limits every
+// category, e.g. "60:error;message, 10:".
+const RateLimitsHeader = "X-Statly-Rate-Limits"
+
+// defaultRetryAfter is the rate limit applied on a 429 response without a
+// valid Retry-After header.
+const defaultRetryAfter = 60 * time.Second
+
+// RateLimitedTransport is implemented by transports that honor rate limits
+// sent by Statly. The client asks it before building an event, so events
+// that would be dropped anyway are not built.
+type RateLimitedTransport interface {
+	// IsRateLimited reports whether events of the category are currently
+	// dropped.
+	IsRateLimited(category Category) bool
+}
+
+// eventCategory returns the rate limit category of an event.
+func eventCategory(event *Event) Category {
+	if len(event.Exception) > 0 {
+		return CategoryError
+	}
+	return CategoryMessage
+}
+
+// recordCategory returns the rate limit category of a serialized event.
+func recordCategory(data []byte) Category {
+	var event struct {
+		Exception json.RawMessage `json:"exception"`
+	}
+	json.Unmarshal(data, &event)
+	if len(event.Exception) > 0 && string(event.Exception) != "null" {
+		return CategoryError
+	}
+	return CategoryMessage
+}
+
+// rateLimits tracks until when each category is rate limited.
+type rateLimits struct {
+	mu        sync.RWMutex
+	deadlines map[Category]time.Time
+}
+
+// newRateLimits creates an empty rate limit state.
+func newRateLimits() *rateLimits {
+	return &rateLimits{deadlines: make(map[Category]time.Time)}
+}
+
+// isLimited reports whether the category is rate limited.
+func (r *rateLimits) isLimited(category Category) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	return now.Before(r.deadlines[category]) || now.Before(r.deadlines[categoryAll])
+}
+
+// update records the rate limits of a response. The rate limits header takes
+// precedence; a 429 response without it limits every category for the
+// duration of its Retry-After header.
+func (r *rateLimits) update(resp *http.Response) {
+	now := time.Now()
+
+	var limits map[Category]time.Time
+	if header := resp.Header.Get(RateLimitsHeader); header != "" {
+		limits = parseRateLimits(header, now)
+	} else if resp.StatusCode == http.StatusTooManyRequests {
+		limits = map[Category]time.Time{
+			categoryAll: now.Add(parseRetryAfter(resp.Header.Get("Retry-After"), now)),
+		}
+	}
+
+	if len(limits) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for category, deadline := range limits {
+		if deadline.After(r.deadlines[category]) {
+			r.deadlines[category] = deadline
+		}
+	}
+}
+
+// parseRateLimits parses a rate limits header. Malformed limits are ignored.
+func parseRateLimits(header string, now time.Time) map[Category]time.Time {
+	limits := make(map[Category]time.Time)
+
+	for _, limit := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(limit), ":")
+
+		seconds, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || seconds <= 0 {
+			continue
+		}
+		deadline := now.Add(time.Duration(seconds * float64(time.Second)))
+
+		categories := ""
+		if len(fields) > 1 {
+			categories = fields[1]
+		}
+		for _, category := range strings.Split(categories, ";") {
+			category := Category(strings.TrimSpace(category))
+			if deadline.After(limits[category]) {
+				limits[category] = deadline
+			}
+		}
+	}
+
+	return limits
+}
+
+// parseRetryAfter parses a Retry-After header holding seconds or an HTTP
+// date, falling back to the default delay.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return defaultRetryAfter
+}
@@ -16,6 +16,11 @@ type Scope struct {
 	maxBreadcrumbs int
 	transaction    string
 	fingerprint    []string
+	level          Level
+	processors     []EventProcessor
+
+	// hub is the hub the scope was pushed on, if any.
+	hub *Hub
 }
 
 // NewScope creates a new scope.
@@ -124,6 +129,31 @@ func (s *Scope) SetFingerprint(fingerprint []string) {
 	s.fingerprint = fingerprint
 }
 
+// SetLevel overrides the level of events captured with this scope.
+func (s *Scope) SetLevel(level Level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.level = level
+}
+
+// AddEventProcessor adds an event processor that runs for every event
+// captured with this scope.
+func (s *Scope) AddEventProcessor(processor EventProcessor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processors = append(s.processors, processor)
+}
+
+// getEventProcessors returns a copy of the scope's event processors.
+func (s *Scope) getEventProcessors() []EventProcessor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	processors := make([]EventProcessor, len(s.processors))
+	copy(processors, s.processors)
+	return processors
+}
+
 // Clear clears all scope data.
 func (s *Scope) Clear() {
 	s.mu.Lock()
@@ -135,6 +165,45 @@ func (s *Scope) Clear() {
 	s.breadcrumbs = make([]Breadcrumb, 0)
 	s.transaction = ""
 	s.fingerprint = nil
+	s.level = ""
+	s.processors = nil
+}
+
+// CaptureException captures an error with the data set on the scope. The
+// event is sent by the client of the hub the scope was pushed on, or of the
+// current hub.
+func (s *Scope) CaptureException(err error) string {
+	return s.CaptureExceptionWithHint(err, nil)
+}
+
+// CaptureExceptionWithHint captures an error with the data set on the scope
+// and passes the hint to event processors and BeforeSend.
+func (s *Scope) CaptureExceptionWithHint(err error, hint *EventHint) string {
+	client := s.client()
+	if client == nil {
+		return ""
+	}
+	return client.captureException(err, nil, hint, s)
+}
+
+// CaptureMessage captures a message with the data set on the scope. The event
+// is sent by the client of the hub the scope was pushed on, or of the current
+// hub.
+func (s *Scope) CaptureMessage(message string, level Level) string {
+	client := s.client()
+	if client == nil {
+		return ""
+	}
+	return client.captureMessage(message, level, nil, nil, s)
+}
+
+// client returns the client that sends events captured with the scope.
+func (s *Scope) client() *Client {
+	hub := s.hub
+	if hub == nil {
+		hub = CurrentHub()
+	}
+	return hub.Client()
 }
 
 // Clone creates a deep copy of this scope.
@@ -166,6 +235,12 @@ func (s *Scope) Clone() *Scope {
 	copy(clone.breadcrumbs, s.breadcrumbs)
 
 	clone.transaction = s.transaction
+	clone.level = s.level
+
+	if s.processors != nil {
+		clone.processors = make([]EventProcessor, len(s.processors))
+		copy(clone.processors, s.processors)
+	}
 
 	if s.fingerprint != nil {
 		clone.fingerprint = make([]string, len(s.fingerprint))
@@ -217,4 +292,34 @@ func (s *Scope) ApplyToEvent(event *Event) {
 			Timestamp: crumb.Timestamp.Format(time.RFC3339),
 		})
 	}
+
+	// Apply level override
+	if s.level != "" {
+		event.Level = s.level
+	}
+
+	// Apply transaction
+	if s.transaction != "" {
+		event.Transaction = s.transaction
+	}
+
+	// Apply fingerprint
+	if len(s.fingerprint) > 0 {
+		event.Fingerprint = expandFingerprint(s.fingerprint, event.Fingerprint)
+	}
+}
+
+// expandFingerprint replaces DefaultFingerprint placeholders with the
+// fingerprint the event already carries. Without one, the placeholder is kept
+// so the server can substitute its default grouping.
+func expandFingerprint(fingerprint, current []string) []string {
+	expanded := make([]string, 0, len(fingerprint))
+	for _, part := range fingerprint {
+		if part == DefaultFingerprint && len(current) > 0 {
+			expanded = append(expanded, current...)
+			continue
+		}
+		expanded = append(expanded, part)
+	}
+	return expanded
 }
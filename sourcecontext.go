@@ -0,0 +1,178 @@
+package statly
+
+import (
+	"bytes"
+	"container/list"
+	"os"
+	"sync"
+)
+
+// Limits of the source context reader.
+const (
+	// DefaultSourceContextLines is the default number of lines read before
+	// and after the line of a frame.
+	DefaultSourceContextLines = 5
+
+	maxSourceFiles      = 64
+	maxSourceFileSize   = 1 << 20
+	maxSourceLineLength = 250
+)
+
+// SourceContextIntegrationName is the name of the source context integration.
+const SourceContextIntegrationName = "SourceContext"
+
+// sourceFile holds the lines of a cached source file. Files that could not be
+// read are cached without lines so they are not read again.
+type sourceFile struct {
+	path  string
+	lines [][]byte
+}
+
+// sourceReader reads source lines from disk, keeping recently used files in
+// an LRU cache.
+type sourceReader struct {
+	mu       sync.Mutex
+	maxFiles int
+	maxSize  int64
+	files    map[string]*list.Element
+	order    *list.List
+}
+
+// newSourceReader creates a source reader caching up to maxFiles files of at
+// most maxSize bytes each.
+func newSourceReader(maxFiles int, maxSize int64) *sourceReader {
+	return &sourceReader{
+		maxFiles: maxFiles,
+		maxSize:  maxSize,
+		files:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// readLines returns the lines of a file, or nil if it cannot be read.
+func (r *sourceReader) readLines(path string) [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if elem, ok := r.files[path]; ok {
+		r.order.MoveToFront(elem)
+		return elem.Value.(*sourceFile).lines
+	}
+
+	file := &sourceFile{path: path, lines: r.load(path)}
+	r.files[path] = r.order.PushFront(file)
+
+	// Evict the least recently used file
+	if r.order.Len() > r.maxFiles {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.files, oldest.Value.(*sourceFile).path)
+	}
+
+	return file.lines
+}
+
+// load reads a file from disk, skipping files larger than the size limit.
+func (r *sourceReader) load(path string) [][]byte {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > r.maxSize {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	return bytes.Split(data, []byte("\n"))
+}
+
+// contextLines returns the line at lineno (1-based) and up to n lines before
+// and after it. It reports false if the line is not available.
+func (r *sourceReader) contextLines(path string, lineno, n int) (pre []string, line string, post []string, ok bool) {
+	lines := r.readLines(path)
+	idx := lineno - 1
+	if idx < 0 || idx >= len(lines) {
+		return nil, "", nil, false
+	}
+
+	start := idx - n
+	if start < 0 {
+		start = 0
+	}
+	end := idx + n + 1
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	for _, l := range lines[start:idx] {
+		pre = append(pre, sourceLine(l))
+	}
+	for _, l := range lines[idx+1 : end] {
+		post = append(post, sourceLine(l))
+	}
+
+	return pre, sourceLine(lines[idx]), post, true
+}
+
+// sourceLine converts a source line to a string, trimming carriage returns
+// and overly long lines.
+func sourceLine(line []byte) string {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > maxSourceLineLength {
+		line = line[:maxSourceLineLength]
+	}
+	return string(line)
+}
+
+// sourceContextIntegration adds source code around in-app frames to events.
+type sourceContextIntegration struct {
+	lines  int
+	reader *sourceReader
+}
+
+// newSourceContextIntegration creates a source context integration reading
+// the given number of lines around each frame.
+func newSourceContextIntegration(lines int) *sourceContextIntegration {
+	if lines <= 0 {
+		lines = DefaultSourceContextLines
+	}
+	return &sourceContextIntegration{
+		lines:  lines,
+		reader: newSourceReader(maxSourceFiles, maxSourceFileSize),
+	}
+}
+
+func (si *sourceContextIntegration) Name() string {
+	return SourceContextIntegrationName
+}
+
+func (si *sourceContextIntegration) SetupOnce(client *Client) {
+	client.AddEventProcessor(func(event *Event, hint *EventHint) *Event {
+		for _, exc := range event.Exception {
+			if exc.Stacktrace == nil {
+				continue
+			}
+			for i := range exc.Stacktrace.Frames {
+				si.addContext(&exc.Stacktrace.Frames[i])
+			}
+		}
+		return event
+	})
+}
+
+// addContext fills the context lines of an in-app frame.
+func (si *sourceContextIntegration) addContext(frame *StackFrame) {
+	if !frame.InApp || frame.AbsPath == "" || frame.Lineno == 0 {
+		return
+	}
+
+	pre, line, post, ok := si.reader.contextLines(frame.AbsPath, frame.Lineno, si.lines)
+	if !ok {
+		return
+	}
+
+	frame.PreContext = pre
+	frame.ContextLine = line
+	frame.PostContext = post
+}
@@ -0,0 +1,498 @@
+package statly
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the disk spool.
+const (
+	DefaultSpoolMaxSize = 64 << 20
+	DefaultSpoolMaxAge  = 24 * time.Hour
+
+	spoolSegmentSize = 1 << 20
+	spoolSuffix      = ".spool"
+	spoolTempSuffix  = ".tmp"
+)
+
+// spoolSegment is a spool file holding serialized events, one per line.
+type spoolSegment struct {
+	seq     uint64
+	size    int64
+	modTime time.Time
+}
+
+// spool is a disk-backed queue of serialized events. Events are appended to
+// segment files named by an increasing sequence number and read back oldest
+// first. A segment is only appended to by the process that created it, so a
+// line torn by a crash can only end a segment and is skipped when read.
+type spool struct {
+	mu          sync.Mutex
+	dir         string
+	maxSize     int64
+	maxAge      time.Duration
+	segmentSize int64
+
+	segments []spoolSegment
+	current  *os.File
+	nextSeq  uint64
+}
+
+// newSpool opens the spool in dir, recovering the segments left by previous
+// processes.
+func newSpool(dir string, maxSize int64, maxAge time.Duration) (*spool, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultSpoolMaxSize
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultSpoolMaxAge
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{
+		dir:         dir,
+		maxSize:     maxSize,
+		maxAge:      maxAge,
+		segmentSize: spoolSegmentSize,
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		// Remove segments left behind by an interrupted rewrite
+		if strings.HasSuffix(name, spoolTempSuffix) {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSuffix), 10, 64)
+		if err != nil || !strings.HasSuffix(name, spoolSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		s.segments = append(s.segments, spoolSegment{seq: seq, size: info.Size(), modTime: info.ModTime()})
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+	s.prune(time.Now())
+
+	return s, nil
+}
+
+// path returns the path of the segment with the given sequence number.
+func (s *spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSuffix))
+}
+
+// append writes records to the newest segment, starting a new segment when
+// it is full.
+func (s *spool) append(records []json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+
+	if s.current == nil || s.segments[len(s.segments)-1].size >= s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.current.Write(buf.Bytes())
+	last := &s.segments[len(s.segments)-1]
+	last.size += int64(n)
+	last.modTime = time.Now()
+	if err == nil {
+		err = s.current.Sync()
+	}
+
+	s.prune(time.Now())
+	return err
+}
+
+// rotate closes the current segment and creates a new one.
+func (s *spool) rotate() error {
+	s.closeCurrent()
+
+	seq := s.nextSeq
+	f, err := os.OpenFile(s.path(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	s.nextSeq++
+	s.current = f
+	s.segments = append(s.segments, spoolSegment{seq: seq, modTime: time.Now()})
+	return nil
+}
+
+// closeCurrent closes the segment being appended to, if any.
+func (s *spool) closeCurrent() {
+	if s.current != nil {
+		s.current.Close()
+		s.current = nil
+	}
+}
+
+// oldest returns the sequence number and the records of the oldest segment.
+// See read.
+func (s *spool) oldest() (uint64, []json.RawMessage, bool) {
+	for _, seq := range s.sequences() {
+		if records, ok := s.read(seq); ok {
+			return seq, records, true
+		}
+	}
+	return 0, nil, false
+}
+
+// sequences returns the sequence numbers of the segments, oldest first.
+func (s *spool) sequences() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(time.Now())
+
+	seqs := make([]uint64, len(s.segments))
+	for i, segment := range s.segments {
+		seqs[i] = segment.seq
+	}
+	return seqs
+}
+
+// read returns the records of a segment. The newest segment is closed for
+// appending first. Lines that are not valid JSON, such as one torn by a
+// crash, are skipped. Segments that cannot be read or hold no records are
+// removed.
+func (s *spool) read(seq uint64) ([]json.RawMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := -1
+	for i := range s.segments {
+		if s.segments[i].seq == seq {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, false
+	}
+	if index == len(s.segments)-1 {
+		s.closeCurrent()
+	}
+
+	data, err := os.ReadFile(s.path(seq))
+	if err != nil {
+		s.removeLocked(seq)
+		return nil, false
+	}
+
+	var records []json.RawMessage
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) > 0 && json.Valid(line) {
+			records = append(records, append(json.RawMessage(nil), line...))
+		}
+	}
+
+	if len(records) == 0 {
+		s.removeLocked(seq)
+		return nil, false
+	}
+
+	return records, true
+}
+
+// empty reports whether the spool holds no segments.
+func (s *spool) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments) == 0
+}
+
+// remove deletes a segment.
+func (s *spool) remove(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(seq)
+}
+
+// removeLocked deletes a segment. s.mu must be held.
+func (s *spool) removeLocked(seq uint64) {
+	for i, segment := range s.segments {
+		if segment.seq == seq {
+			if i == len(s.segments)-1 {
+				s.closeCurrent()
+			}
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	os.Remove(s.path(seq))
+}
+
+// rewrite replaces the records of a segment that was partially delivered.
+// The segment is written to a temporary file and renamed so a crash leaves
+// either the old or the new records.
+func (s *spool) rewrite(seq uint64, records []json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := -1
+	for i := range s.segments {
+		if s.segments[i].seq == seq {
+			index = i
+		}
+	}
+	if index < 0 {
+		// The segment was pruned while its events were being sent
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+
+	tmp := s.path(seq) + spoolTempSuffix
+	if err := writeFileSync(tmp, buf.Bytes()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.path(seq)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.segments[index].size = int64(buf.Len())
+	return nil
+}
+
+// writeFileSync writes data to a new file and syncs it to disk before
+// returning.
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prune deletes segments older than the maximum age, then the oldest
+// segments while the spool exceeds its maximum size. s.mu must be held.
+func (s *spool) prune(now time.Time) {
+	for len(s.segments) > 0 && now.Sub(s.segments[0].modTime) > s.maxAge {
+		s.removeLocked(s.segments[0].seq)
+	}
+
+	var total int64
+	for _, segment := range s.segments {
+		total += segment.size
+	}
+	for len(s.segments) > 1 && total > s.maxSize {
+		total -= s.segments[0].size
+		s.removeLocked(s.segments[0].seq)
+	}
+}
+
+// close closes the segment being appended to.
+func (s *spool) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeCurrent()
+}
+
+// spooledEnvelope is the spool record of an envelope. Envelopes are stored
+// encoded, between the records of events.
+type spooledEnvelope struct {
+	Envelope []byte `json:"envelope"`
+}
+
+// envelopeRecord returns the spool record of an envelope.
+func envelopeRecord(envelope *Envelope) ([]byte, error) {
+	data, err := envelope.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(spooledEnvelope{Envelope: data})
+}
+
+// decodeEnvelopeRecord returns the envelope of a spool record and whether the
+// record holds one rather than an event. The envelope is nil if it cannot be
+// decoded.
+func decodeEnvelopeRecord(record json.RawMessage) (*Envelope, bool) {
+	var spooled spooledEnvelope
+	if err := json.Unmarshal(record, &spooled); err != nil || len(spooled.Envelope) == 0 {
+		return nil, false
+	}
+	envelope, err := DecodeEnvelope(bytes.NewReader(spooled.Envelope))
+	if err != nil {
+		return nil, true
+	}
+	return envelope, true
+}
+
+// spoolEnvelope writes an envelope that could not be sent to the spool.
+func (t *HTTPTransport) spoolEnvelope(envelope *Envelope) {
+	record, err := envelopeRecord(envelope)
+	if err != nil {
+		if t.options.Debug {
+			log.Printf("[statly] Failed to spool envelope: %v", err)
+		}
+		return
+	}
+	t.spoolRecords([]json.RawMessage{record})
+}
+
+// spoolRecords writes events that could not be sent to the spool.
+func (t *HTTPTransport) spoolRecords(records []json.RawMessage) {
+	if err := t.spool.append(records); err != nil {
+		if t.options.Debug {
+			log.Printf("[statly] Failed to spool %d events: %v", len(records), err)
+		}
+		return
+	}
+	if t.options.Debug {
+		log.Printf("[statly] Spooled %d events", len(records))
+	}
+}
+
+// replaySpool sends spooled events and envelopes oldest first. Events and
+// envelope items of rate limited categories are held on disk until their
+// limit expires. It stops at the first request that cannot be delivered,
+// keeping it and later records on disk, and reports whether every spooled
+// record that is not rate limited was delivered.
+func (t *HTTPTransport) replaySpool() bool {
+	for _, seq := range t.spool.sequences() {
+		records, ok := t.spool.read(seq)
+		if !ok {
+			continue
+		}
+
+		held, pending := t.splitRecords(records)
+		unchanged := len(pending) == 0 && len(held) == len(records)
+
+		for len(pending) > 0 {
+			// Envelopes that can share a request are merged, events are
+			// sent in batches
+			var n, result int
+			if envelope, ok := decodeEnvelopeRecord(pending[0]); ok {
+				n, result = 1, sendRejected
+				if envelope != nil {
+					for n < len(pending) && n < t.options.BatchSize {
+						next, ok := decodeEnvelopeRecord(pending[n])
+						if !ok || next == nil || !envelope.canMerge(next) {
+							break
+						}
+						envelope = envelope.merge(next)
+						n++
+					}
+					result = t.postEnvelope(envelope)
+				}
+			} else {
+				for n < len(pending) && n < t.options.BatchSize {
+					if _, ok := decodeEnvelopeRecord(pending[n]); ok {
+						break
+					}
+					n++
+				}
+				result = t.send(pending[:n])
+			}
+
+			// Records Statly rejects are dropped like those sent directly
+			if result == sendUnreachable || result == sendRateLimited {
+				if err := t.spool.rewrite(seq, append(held, pending...)); err != nil && t.options.Debug {
+					log.Printf("[statly] Failed to rewrite spool segment: %v", err)
+				}
+				return false
+			}
+			pending = pending[n:]
+		}
+
+		if len(held) == 0 {
+			t.spool.remove(seq)
+		} else if !unchanged {
+			if err := t.spool.rewrite(seq, held); err != nil && t.options.Debug {
+				log.Printf("[statly] Failed to rewrite spool segment: %v", err)
+			}
+		}
+	}
+
+	return true
+}
+
+// splitRecords splits spool records into those of rate limited categories,
+// which are held, and those to send. Envelopes are split by item.
+func (t *HTTPTransport) splitRecords(records []json.RawMessage) (held, pending []json.RawMessage) {
+	for _, record := range records {
+		envelope, ok := decodeEnvelopeRecord(record)
+		if !ok {
+			if t.limits.isLimited(recordCategory(record)) {
+				held = append(held, record)
+			} else {
+				pending = append(pending, record)
+			}
+			continue
+		}
+		if envelope == nil {
+			pending = append(pending, record)
+			continue
+		}
+
+		allowed, limited := envelope.splitLimited(t.limits)
+		if limited == nil {
+			pending = append(pending, record)
+			continue
+		}
+		if data, err := envelopeRecord(limited); err == nil {
+			held = append(held, data)
+		}
+		if allowed != nil {
+			if data, err := envelopeRecord(allowed); err == nil {
+				pending = append(pending, data)
+			}
+		}
+	}
+	return held, pending
+}
@@ -0,0 +1,461 @@
+package statly
+
+import (
+	"path"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxStackFrames is the default number of frames kept per stack trace.
+const DefaultMaxStackFrames = 100
+
+// maxCapturedFrames bounds the number of frames read from the runtime for a
+// single stack trace.
+const maxCapturedFrames = 1024
+
+// sdkModule is the package path prefix of this SDK. Its frames are removed
+// from stack traces.
+const sdkModule = "github.com/KodyDennon/statly-go"
+
+// captureStacktrace captures the current stack trace.
+func captureStacktrace(skip int) *Stacktrace {
+	pcs := make([]uintptr, maxCapturedFrames)
+	n := runtime.Callers(skip+1, pcs)
+
+	return stacktraceFromPCs(pcs[:n])
+}
+
+// capturePanicStacktrace captures the stack of a goroutine recovering from a
+// panic, starting at the call that panicked rather than at the deferred
+// function recovering it. It returns nil if no panic is in progress.
+func capturePanicStacktrace() *Stacktrace {
+	pcs := make([]uintptr, maxCapturedFrames)
+	n := runtime.Callers(1, pcs)
+
+	frames := framesFromPCs(pcs[:n])
+	for i, frame := range frames {
+		if frame.Module == "runtime" && frame.Function == "gopanic" {
+			return newStacktrace(frames[i+1:])
+		}
+	}
+
+	return nil
+}
+
+// stacktraceFromPCs builds a stack trace from program counters as returned by
+// runtime.Callers, innermost call first.
+func stacktraceFromPCs(pcs []uintptr) *Stacktrace {
+	return newStacktrace(framesFromPCs(pcs))
+}
+
+// framesFromPCs resolves program counters to stack frames, innermost call
+// first.
+func framesFromPCs(pcs []uintptr) []StackFrame {
+	var frames []StackFrame
+
+	runtimeFrames := runtime.CallersFrames(pcs)
+
+	for {
+		frame, more := runtimeFrames.Next()
+
+		// Skip runtime frames
+		if frame.Function == "" {
+			if !more {
+				break
+			}
+			continue
+		}
+
+		frames = append(frames, newStackFrame(frame.Function, frame.File, frame.Line))
+
+		if !more {
+			break
+		}
+	}
+
+	return frames
+}
+
+// newStacktrace creates a stack trace from frames ordered innermost call
+// first. Frames of the SDK and of the runtime are dropped; nil is returned if
+// no frames remain.
+func newStacktrace(frames []StackFrame) *Stacktrace {
+	frames = trimSDKFrames(frames)
+	if len(frames) == 0 {
+		return nil
+	}
+
+	reverseFrames(frames)
+
+	return &Stacktrace{Frames: frames}
+}
+
+// trimSDKFrames removes the frames of the SDK and of the runtime wherever
+// they appear, so stack traces hold only the application's calls.
+func trimSDKFrames(frames []StackFrame) []StackFrame {
+	kept := frames[:0]
+	for _, frame := range frames {
+		if !isSDKFrame(frame) {
+			kept = append(kept, frame)
+		}
+	}
+	return kept
+}
+
+// isSDKFrame reports whether a frame belongs to the SDK or to the runtime.
+func isSDKFrame(frame StackFrame) bool {
+	return frame.Module == "runtime" || hasPathPrefix(frame.Module, sdkModule)
+}
+
+// limitFrames caps the number of frames of each stack trace of the event.
+// Frames are removed from the middle, keeping both the outermost and the
+// innermost calls, and the removed range is recorded as omitted.
+func limitFrames(event *Event, max int) {
+	if max <= 0 {
+		return
+	}
+	for _, exc := range event.Exception {
+		if exc.Stacktrace != nil {
+			omitFrames(exc.Stacktrace, max)
+		}
+	}
+}
+
+// omitFrames removes frames from the middle of the stack trace until at most
+// keep frames are left. The removed range is recorded as omitted, in indices
+// of the original stack trace, merged with the range omitted before.
+func omitFrames(st *Stacktrace, keep int) {
+	if keep < 0 {
+		keep = 0
+	}
+	if len(st.Frames) <= keep {
+		return
+	}
+
+	head := keep / 2
+	tail := len(st.Frames) - (keep - head)
+
+	frames := make([]StackFrame, 0, keep)
+	frames = append(frames, st.Frames[:head]...)
+	frames = append(frames, st.Frames[tail:]...)
+	st.Frames = frames
+
+	start, end := head, tail
+	if len(st.FramesOmitted) == 2 {
+		prevStart, prevEnd := st.FramesOmitted[0], st.FramesOmitted[1]
+		if start > prevStart {
+			start += prevEnd - prevStart
+		}
+		if end > prevStart {
+			end += prevEnd - prevStart
+		}
+		if prevStart < start {
+			start = prevStart
+		}
+		if prevEnd > end {
+			end = prevEnd
+		}
+	}
+	st.FramesOmitted = []int{start, end}
+}
+
+// newStackFrame creates a stack frame for a fully qualified function at a
+// source location.
+func newStackFrame(name, file string, line int) StackFrame {
+	module, function := splitFunctionName(name)
+	resolver := getDefaultInAppResolver()
+	return StackFrame{
+		Filename: resolver.relativeFilename(module, file),
+		Function: function,
+		Module:   module,
+		Lineno:   line,
+		AbsPath:  file,
+		InApp:    resolver.isInApp(module),
+	}
+}
+
+// reverseFrames reverses frames so the outermost call comes first and the
+// innermost call last.
+func reverseFrames(frames []StackFrame) {
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+}
+
+// extractErrorStacktrace returns the stack trace recorded by an error when it
+// was created, or nil if the error carries none.
+//
+// Errors are inspected by method signature so no dependency on the packages
+// producing them is needed:
+//
+//   - Callers() []uintptr
+//   - StackTrace() T, where T is a slice of program counters
+//     (github.com/pkg/errors)
+//   - StackFrames() []T, where T has File, LineNumber and Name fields
+//     (github.com/go-errors/errors)
+func extractErrorStacktrace(err error) (stacktrace *Stacktrace) {
+	// Methods of foreign error types must not break the capture
+	defer func() {
+		if recover() != nil {
+			stacktrace = nil
+		}
+	}()
+
+	if e, ok := err.(interface{ Callers() []uintptr }); ok {
+		return stacktraceFromPCs(e.Callers())
+	}
+
+	v := reflect.ValueOf(err)
+
+	if method := v.MethodByName("StackTrace"); method.IsValid() {
+		if pcs := programCountersFrom(method); pcs != nil {
+			return stacktraceFromPCs(pcs)
+		}
+	}
+
+	if method := v.MethodByName("StackFrames"); method.IsValid() {
+		if frames := stackFramesFrom(method); frames != nil {
+			return &Stacktrace{Frames: frames}
+		}
+	}
+
+	return nil
+}
+
+// programCountersFrom calls a method returning a slice of program counters.
+func programCountersFrom(method reflect.Value) []uintptr {
+	t := method.Type()
+	if t.NumIn() != 0 || t.NumOut() != 1 {
+		return nil
+	}
+	if out := t.Out(0); out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+
+	result := method.Call(nil)[0]
+	pcs := make([]uintptr, result.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(result.Index(i).Uint())
+	}
+	return pcs
+}
+
+// stackFramesFrom calls a method returning a slice of frame structs with File,
+// LineNumber and Name fields, innermost call first.
+func stackFramesFrom(method reflect.Value) []StackFrame {
+	t := method.Type()
+	if t.NumIn() != 0 || t.NumOut() != 1 {
+		return nil
+	}
+	out := t.Out(0)
+	if out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	elem := out.Elem()
+	file, ok := elem.FieldByName("File")
+	if !ok || file.Type.Kind() != reflect.String {
+		return nil
+	}
+	line, ok := elem.FieldByName("LineNumber")
+	if !ok || line.Type.Kind() != reflect.Int {
+		return nil
+	}
+	name, ok := elem.FieldByName("Name")
+	if !ok || name.Type.Kind() != reflect.String {
+		return nil
+	}
+	pkg, hasPackage := elem.FieldByName("Package")
+	if hasPackage && pkg.Type.Kind() != reflect.String {
+		hasPackage = false
+	}
+
+	result := method.Call(nil)[0]
+	frames := make([]StackFrame, 0, result.Len())
+	for i := 0; i < result.Len(); i++ {
+		f := result.Index(i)
+
+		function := f.FieldByIndex(name.Index).String()
+		if hasPackage {
+			if p := f.FieldByIndex(pkg.Index).String(); p != "" {
+				function = p + "." + function
+			}
+		}
+
+		frames = append(frames, newStackFrame(
+			function,
+			f.FieldByIndex(file.Index).String(),
+			int(f.FieldByIndex(line.Index).Int()),
+		))
+	}
+
+	if len(frames) == 0 {
+		return nil
+	}
+
+	reverseFrames(frames)
+	return frames
+}
+
+// inAppResolver decides whether stack frames belong to the application.
+type inAppResolver struct {
+	include     []string
+	exclude     []string
+	mainModule  string
+	mainPackage string
+}
+
+var (
+	defaultInApp     *inAppResolver
+	defaultInAppOnce sync.Once
+)
+
+// getDefaultInAppResolver returns the resolver used when no options apply.
+func getDefaultInAppResolver() *inAppResolver {
+	defaultInAppOnce.Do(func() {
+		defaultInApp = newInAppResolver(nil, nil)
+	})
+	return defaultInApp
+}
+
+// newInAppResolver creates a resolver with include and exclude package
+// prefixes. The main module is detected from the build info.
+func newInAppResolver(include, exclude []string) *inAppResolver {
+	r := &inAppResolver{
+		include: include,
+		exclude: exclude,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		r.mainModule = info.Main.Path
+		r.mainPackage = info.Path
+	}
+	return r
+}
+
+// isInApp reports whether code in the given package belongs to the
+// application. Exclusions win over inclusions; packages of the main module
+// are in-app, the standard library is not. When the main module is unknown,
+// every package outside the standard library is considered in-app.
+func (r *inAppResolver) isInApp(module string) bool {
+	module = testedPackage(module)
+	for _, prefix := range r.exclude {
+		if hasPathPrefix(module, prefix) {
+			return false
+		}
+	}
+	for _, prefix := range r.include {
+		if hasPathPrefix(module, prefix) {
+			return true
+		}
+	}
+
+	if module == "main" {
+		return true
+	}
+	if r.mainModule != "" && r.mainModule != "command-line-arguments" {
+		return hasPathPrefix(module, r.mainModule)
+	}
+
+	return !isStandardLibrary(module)
+}
+
+// relativeFilename returns the path of a source file relative to the root it
+// was compiled from: the main module, a GOROOT or GOPATH source tree, or the
+// module cache. Paths that match none of them are returned unchanged.
+func (r *inAppResolver) relativeFilename(module, file string) string {
+	if module == "" || !path.IsAbs(file) {
+		return file
+	}
+	dir := path.Dir(file)
+
+	// Frames of the main package report the module "main"; its files lie at
+	// the import path of the main package, e.g. cmd/server in the module.
+	if module == "main" && r.mainPackage != "" {
+		module = r.mainPackage
+	}
+	module = testedPackage(module)
+
+	// Packages of the main module lie below the module root at their path
+	// relative to the module.
+	if r.mainModule != "" && hasPathPrefix(module, r.mainModule) {
+		rel := module[len(r.mainModule):]
+		if strings.HasSuffix(dir, rel) {
+			return strings.TrimPrefix(file, dir[:len(dir)-len(rel)]+"/")
+		}
+	}
+
+	// GOROOT and GOPATH source trees and vendor directories lay out packages
+	// by import path.
+	if strings.HasSuffix(dir, "/"+module) {
+		return module + "/" + path.Base(file)
+	}
+
+	// The module cache keeps the module version in the path.
+	if i := strings.LastIndex(file, "/pkg/mod/"); i >= 0 {
+		return file[i+len("/pkg/mod/"):]
+	}
+
+	return file
+}
+
+// testedPackage returns the package an external test package tests, e.g.
+// "example.com/app/orders" for "example.com/app/orders_test", whose files
+// lie in the same directory. Other packages are returned unchanged.
+func testedPackage(module string) string {
+	return strings.TrimSuffix(module, "_test")
+}
+
+// apply sets InApp on every frame of the event.
+func (r *inAppResolver) apply(event *Event) {
+	for _, exc := range event.Exception {
+		if exc.Stacktrace == nil {
+			continue
+		}
+		for i := range exc.Stacktrace.Frames {
+			frame := &exc.Stacktrace.Frames[i]
+			frame.InApp = r.isInApp(frame.Module)
+		}
+	}
+}
+
+// hasPathPrefix reports whether a package path equals prefix or lies below it.
+// A prefix ending in "/" or "." matches any path starting with it.
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "" || !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	if len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || strings.HasSuffix(prefix, ".") {
+		return true
+	}
+	return path[len(prefix)] == '/'
+}
+
+// splitFunctionName splits a fully qualified function name into its package
+// path and the function name within the package, e.g.
+// "github.com/gin-gonic/gin.(*Context).Next" into "github.com/gin-gonic/gin"
+// and "(*Context).Next". Dots in the last element of a package path are
+// escaped as "%2e" in symbol names and unescaped in the result.
+func splitFunctionName(name string) (module, function string) {
+	start := strings.LastIndex(name, "/") + 1
+	dot := strings.Index(name[start:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return strings.ReplaceAll(name[:start+dot], "%2e", "."), name[start+dot+1:]
+}
+
+// isStandardLibrary checks if a package is from the Go standard library.
+// Standard library packages have no dot in the first path element.
+func isStandardLibrary(module string) bool {
+	if module == "" || module == "main" {
+		return false
+	}
+	first := module
+	if i := strings.Index(module, "/"); i >= 0 {
+		first = module[:i]
+	}
+	return !strings.Contains(first, ".")
+}
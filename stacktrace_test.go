@@ -0,0 +1,358 @@
+// Tests of stack traces built from the SDK's capture paths. They live in an
+// external test package so their functions are application frames, as they
+// would be in a program using the SDK, rather than SDK frames.
+package statly_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KodyDennon/statly-go"
+	"github.com/KodyDennon/statly-go/middleware"
+)
+
+var errSentinel = errors.New("not found")
+
+func captureFromFirstSite(client *statly.Client) {
+	client.CaptureException(errSentinel)
+}
+
+func captureFromSecondSite(client *statly.Client) {
+	client.CaptureException(errSentinel)
+}
+
+func TestDeduplicationCallSites(t *testing.T) {
+	transport := statly.NewMockTransport()
+
+	client, _ := statly.NewClient(statly.Options{
+		DSN:          "https://sk_test_xxx@statly.live/test",
+		Transport:    transport,
+		DedupeWindow: time.Hour,
+	})
+
+	for i := 0; i < 2; i++ {
+		captureFromFirstSite(client)
+		captureFromSecondSite(client)
+	}
+
+	if n := len(transport.Events()); n != 2 {
+		t.Errorf("Expected one event per call site, got %d", n)
+	}
+}
+
+// Types mimicking errors that record where they were created.
+type (
+	testFrame      uintptr
+	testStackTrace []testFrame
+	testGoFrame    struct {
+		File           string
+		LineNumber     int
+		Name           string
+		Package        string
+		ProgramCounter uintptr
+	}
+)
+
+type callersError struct{ pcs []uintptr }
+
+func (e *callersError) Error() string      { return "callers error" }
+func (e *callersError) Callers() []uintptr { return e.pcs }
+
+type pkgStackError struct{ stack testStackTrace }
+
+func (e *pkgStackError) Error() string              { return "pkg stack error" }
+func (e *pkgStackError) StackTrace() testStackTrace { return e.stack }
+
+type goStackError struct{ frames []testGoFrame }
+
+func (e *goStackError) Error() string              { return "go stack error" }
+func (e *goStackError) StackFrames() []testGoFrame { return e.frames }
+
+func newCallersError() *callersError {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	return &callersError{pcs: pcs[:n]}
+}
+
+func newPkgStackError() *pkgStackError {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	stack := make(testStackTrace, n)
+	for i := range stack {
+		stack[i] = testFrame(pcs[i])
+	}
+	return &pkgStackError{stack: stack}
+}
+
+func hasFrame(stacktrace *statly.Stacktrace, function string) bool {
+	if stacktrace == nil {
+		return false
+	}
+	for _, frame := range stacktrace.Frames {
+		if frame.Function == function {
+			return true
+		}
+	}
+	return false
+}
+
+func TestErrorStacktrace(t *testing.T) {
+	transport := statly.NewMockTransport()
+
+	client, _ := statly.NewClient(statly.Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	client.CaptureException(newCallersError())
+	client.CaptureException(newPkgStackError())
+	client.CaptureException(fmt.Errorf("wrapped: %w", &goStackError{frames: []testGoFrame{
+		{File: "/app/orders/repo.go", LineNumber: 42, Name: "(*Repo).Find", Package: "example.com/app/orders"},
+		{File: "/app/main.go", LineNumber: 10, Name: "main", Package: "main"},
+	}}))
+
+	events := transport.Events()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+
+	if !hasFrame(events[0].Exception[0].Stacktrace, "newCallersError") {
+		t.Errorf("Expected stack trace from Callers()")
+	}
+
+	if !hasFrame(events[1].Exception[0].Stacktrace, "newPkgStackError") {
+		t.Errorf("Expected stack trace from StackTrace()")
+	}
+
+	wrapped := events[2].Exception
+	if hasFrame(wrapped[0].Stacktrace, "(*Repo).Find") {
+		t.Errorf("Expected wrapper to keep the capture site stack trace")
+	}
+
+	frames := wrapped[1].Stacktrace.Frames
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 frames from StackFrames(), got %d", len(frames))
+	}
+
+	innermost := frames[len(frames)-1]
+	if innermost.Module != "example.com/app/orders" || innermost.Function != "(*Repo).Find" || innermost.Lineno != 42 {
+		t.Errorf("Expected innermost frame to be last, got %+v", innermost)
+	}
+}
+
+func TestSourceContext(t *testing.T) {
+	transport := statly.NewMockTransport()
+
+	client, _ := statly.NewClient(statly.Options{
+		DSN:                "https://sk_test_xxx@statly.live/test",
+		Transport:          transport,
+		SourceContext:      true,
+		SourceContextLines: 2,
+	})
+
+	client.CaptureException(errors.New("source context")) // capture site
+
+	stacktrace := transport.Events()[0].Exception[0].Stacktrace
+
+	var frame *statly.StackFrame
+	for i := range stacktrace.Frames {
+		if stacktrace.Frames[i].Function == "TestSourceContext" {
+			frame = &stacktrace.Frames[i]
+		}
+	}
+	if frame == nil {
+		t.Fatalf("Expected a frame for the test function")
+	}
+
+	if !strings.Contains(frame.ContextLine, "// capture site") {
+		t.Errorf("Expected context line of the capture site, got %q", frame.ContextLine)
+	}
+
+	if len(frame.PreContext) != 2 || len(frame.PostContext) != 2 {
+		t.Errorf("Expected 2 lines of pre and post context, got %d and %d", len(frame.PreContext), len(frame.PostContext))
+	}
+}
+
+func TestSDKFramesTrimmed(t *testing.T) {
+	transport := statly.NewMockTransport()
+
+	client, _ := statly.NewClient(statly.Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	client.CaptureException(errors.New("test error"))
+
+	frames := transport.Events()[0].Exception[0].Stacktrace.Frames
+	last := frames[len(frames)-1]
+	if last.Function != "TestSDKFramesTrimmed" {
+		t.Errorf("Expected innermost frame to be the test, got %s.%s", last.Module, last.Function)
+	}
+	if last.Filename != "stacktrace_test.go" {
+		t.Errorf("Expected filename relative to the module root, got %s", last.Filename)
+	}
+	if !filepath.IsAbs(last.AbsPath) {
+		t.Errorf("Expected absolute path, got %s", last.AbsPath)
+	}
+}
+
+func TestSDKFramesRemovedThroughout(t *testing.T) {
+	transport := statly.NewMockTransport()
+	sent := make(chan *statly.Event, 2)
+
+	client, _ := statly.NewClient(statly.Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+		BeforeSend: func(event *statly.Event, hint *statly.EventHint) *statly.Event {
+			sent <- event
+			return event
+		},
+	})
+	ctx := statly.SetHubOnContext(context.Background(), client.Hub())
+
+	// A panic in a handler wrapped by the recovery middleware
+	handler := middleware.Recovery(middleware.Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panicWith("handler failure")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	// A panic in a goroutine started by the SDK
+	statly.Go(ctx, func(ctx context.Context) {
+		panicWith("worker failure")
+	})
+
+	for i := 0; i < 2; i++ {
+		var event *statly.Event
+		select {
+		case event = <-sent:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 2 events, got %d", i)
+		}
+
+		frames := event.Exception[0].Stacktrace.Frames
+		for _, frame := range frames {
+			sdk := strings.HasPrefix(frame.Module, "github.com/KodyDennon/statly-go") && !strings.HasSuffix(frame.Module, "_test")
+			if frame.Module == "runtime" || sdk {
+				t.Errorf("%s: expected SDK and runtime frames to be removed, got %s.%s",
+					event.Exception[0].Value, frame.Module, frame.Function)
+			}
+		}
+		if last := frames[len(frames)-1]; last.Function != "panicWith" {
+			t.Errorf("%s: expected stack trace to end at the panic site, got %s", event.Exception[0].Value, last.Function)
+		}
+	}
+}
+
+func TestMaxStackFrames(t *testing.T) {
+	transport := statly.NewMockTransport()
+
+	client, _ := statly.NewClient(statly.Options{
+		DSN:            "https://sk_test_xxx@statly.live/test",
+		Transport:      transport,
+		MaxStackFrames: 4,
+	})
+
+	var recurse func(n int)
+	recurse = func(n int) {
+		if n == 0 {
+			client.CaptureException(errors.New("deep error"))
+			return
+		}
+		recurse(n - 1)
+	}
+	recurse(20)
+
+	st := transport.Events()[0].Exception[0].Stacktrace
+	if len(st.Frames) != 4 {
+		t.Fatalf("Expected 4 frames, got %d", len(st.Frames))
+	}
+	if len(st.FramesOmitted) != 2 || st.FramesOmitted[0] != 2 || st.FramesOmitted[1] <= 2 {
+		t.Errorf("Expected omitted frames after the first 2, got %v", st.FramesOmitted)
+	}
+	if st.Frames[0].Module != "testing" || st.Frames[3].Function != "TestMaxStackFrames.func1" {
+		t.Errorf("Expected outermost and innermost frames to be kept, got %s and %s",
+			st.Frames[0].Function, st.Frames[3].Function)
+	}
+}
+
+func panicWith(v interface{}) {
+	panic(v)
+}
+
+func TestCapturePanic(t *testing.T) {
+	transport := statly.NewMockTransport()
+
+	client, _ := statly.NewClient(statly.Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	capture := func(v interface{}, hint *statly.EventHint) {
+		defer func() {
+			client.CapturePanicWithHint(recover(), hint)
+		}()
+		panicWith(v)
+	}
+
+	capture(42, nil)
+	capture(errors.New("server failure"), &statly.EventHint{Mechanism: statly.MechanismHTTPServer})
+
+	events := transport.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	exc := events[0].Exception[0]
+	if exc.Type != "int" || exc.Value != "42" {
+		t.Errorf("Expected panic value type and value, got %s: %s", exc.Type, exc.Value)
+	}
+	if exc.Mechanism.Type != statly.MechanismPanic || exc.Mechanism.Handled {
+		t.Errorf("Expected unhandled panic mechanism, got %+v", exc.Mechanism)
+	}
+
+	frames := exc.Stacktrace.Frames
+	if last := frames[len(frames)-1]; last.Function != "panicWith" {
+		t.Errorf("Expected stack trace to end at the panic site, got %s", last.Function)
+	}
+
+	exc = events[1].Exception[0]
+	if exc.Type != "*errors.errorString" || exc.Mechanism.Type != statly.MechanismHTTPServer || exc.Mechanism.Handled {
+		t.Errorf("Expected unhandled http.server error, got %s %+v", exc.Type, exc.Mechanism)
+	}
+}
+
+func TestCapturePanicRuntimeError(t *testing.T) {
+	transport := statly.NewMockTransport()
+
+	client, _ := statly.NewClient(statly.Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	func() {
+		defer func() {
+			client.CapturePanic(recover())
+		}()
+		var values []int
+		_ = values[len(os.Args)+1]
+	}()
+
+	exc := transport.Events()[0].Exception[0]
+	if exc.Type != "runtime.boundsError" {
+		t.Errorf("Expected runtime error type, got %s", exc.Type)
+	}
+
+	frames := exc.Stacktrace.Frames
+	if last := frames[len(frames)-1]; last.Function != "TestCapturePanicRuntimeError.func1" {
+		t.Errorf("Expected stack trace to end at the faulting function, got %s", last.Function)
+	}
+}
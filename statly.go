@@ -33,8 +33,6 @@
 package statly
 
 import (
-	"errors"
-	"fmt"
 	"os"
 	"runtime"
 	"sync"
@@ -73,16 +71,58 @@ type Options struct {
 	MaxBreadcrumbs int
 
 	// BeforeSend is a callback to modify or drop events before sending.
-	BeforeSend func(*Event) *Event
+	// The hint carries the original error, panic value or request, if any.
+	BeforeSend func(*Event, *EventHint) *Event
 
 	// Transport is a custom transport for sending events.
 	Transport Transport
 
+	// Destinations are additional destinations that receive every event
+	// alongside the DSN, each with its own optional BeforeSend filter.
+	Destinations []Destination
+
 	// ServerName overrides the default server name.
 	ServerName string
 
 	// FlushTimeout is the timeout for flushing events on close.
 	FlushTimeout time.Duration
+
+	// MaxErrorDepth is the maximum number of wrapping levels recorded for an
+	// error chain.
+	MaxErrorDepth int
+
+	// MaxStackFrames is the maximum number of frames kept per stack trace.
+	// Frames are removed from the middle of longer stack traces.
+	MaxStackFrames int
+
+	// DedupeWindow is the time window in which identical exception events
+	// are suppressed by the Dedupe integration. A negative value disables
+	// deduplication.
+	DedupeWindow time.Duration
+
+	// Limits bounds the size of events. Zero fields use the defaults.
+	Limits EventLimits
+
+	// InAppInclude lists package path prefixes whose frames are always
+	// marked as in-app.
+	InAppInclude []string
+
+	// InAppExclude lists package path prefixes whose frames are never marked
+	// as in-app. It takes precedence over InAppInclude.
+	InAppExclude []string
+
+	// SourceContext adds the source code around in-app stack frames to
+	// events. Sources are read from disk, so this is only useful where the
+	// sources are deployed alongside the binary.
+	SourceContext bool
+
+	// SourceContextLines is the number of lines read before and after the
+	// line of each frame.
+	SourceContextLines int
+
+	// Integrations selects the integrations installed on the client. It
+	// receives DefaultIntegrations() and returns the integrations to use.
+	Integrations func([]Integration) []Integration
 }
 
 // User represents user context attached to events.
@@ -105,17 +145,24 @@ type Breadcrumb struct {
 }
 
 var (
-	globalClient *Client
-	globalMu     sync.RWMutex
+	globalHub = NewHub(nil, NewScope())
+	globalMu  sync.RWMutex
 )
 
+// CurrentHub returns the global hub.
+func CurrentHub() *Hub {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return globalHub
+}
+
 // Init initializes the Statly SDK with the given options.
 func Init(options Options) error {
 	globalMu.Lock()
 	defer globalMu.Unlock()
 
-	if globalClient != nil {
-		return errors.New("statly: SDK already initialized, call Close() first")
+	if client := globalHub.Client(); client != nil && client.IsEnabled() {
+		return ErrAlreadyInitialized
 	}
 
 	client, err := NewClient(options)
@@ -123,176 +170,124 @@ func Init(options Options) error {
 		return err
 	}
 
-	globalClient = client
+	globalHub = client.Hub()
 	return nil
 }
 
 // CaptureException captures an error and sends it to Statly.
 func CaptureException(err error) string {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
-
-	if client == nil {
-		return ""
-	}
-	return client.CaptureException(err)
+	return CurrentHub().CaptureException(err)
 }
 
 // CaptureExceptionWithContext captures an error with additional context.
 func CaptureExceptionWithContext(err error, ctx map[string]interface{}) string {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
+	return CurrentHub().CaptureExceptionWithContext(err, ctx)
+}
 
-	if client == nil {
-		return ""
-	}
-	return client.CaptureExceptionWithContext(err, ctx)
+// CaptureExceptionWithHint captures an error and passes the hint to event
+// processors and BeforeSend.
+func CaptureExceptionWithHint(err error, hint *EventHint) string {
+	return CurrentHub().CaptureExceptionWithHint(err, hint)
 }
 
 // CaptureMessage captures a message and sends it to Statly.
 func CaptureMessage(message string, level Level) string {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
-
-	if client == nil {
-		return ""
-	}
-	return client.CaptureMessage(message, level)
+	return CurrentHub().CaptureMessage(message, level)
 }
 
 // CaptureMessageWithContext captures a message with additional context.
 func CaptureMessageWithContext(message string, level Level, ctx map[string]interface{}) string {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
+	return CurrentHub().CaptureMessageWithContext(message, level, ctx)
+}
 
-	if client == nil {
-		return ""
-	}
-	return client.CaptureMessageWithContext(message, level, ctx)
+// CaptureMessageWithHint captures a message and passes the hint to event
+// processors and BeforeSend.
+func CaptureMessageWithHint(message string, level Level, hint *EventHint) string {
+	return CurrentHub().CaptureMessageWithHint(message, level, hint)
 }
 
 // SetUser sets the current user context.
 func SetUser(user User) {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
-
-	if client != nil {
-		client.SetUser(user)
-	}
+	CurrentHub().SetUser(user)
 }
 
 // SetTag sets a tag on the current scope.
 func SetTag(key, value string) {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
-
-	if client != nil {
-		client.SetTag(key, value)
-	}
+	CurrentHub().SetTag(key, value)
 }
 
 // SetTags sets multiple tags on the current scope.
 func SetTags(tags map[string]string) {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
-
-	if client != nil {
-		client.SetTags(tags)
-	}
+	CurrentHub().SetTags(tags)
 }
 
 // SetExtra sets extra data on the current scope.
 func SetExtra(key string, value interface{}) {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
-
-	if client != nil {
-		client.SetExtra(key, value)
-	}
+	CurrentHub().SetExtra(key, value)
 }
 
 // AddBreadcrumb adds a breadcrumb to the current scope.
 func AddBreadcrumb(crumb Breadcrumb) {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
-
-	if client != nil {
-		client.AddBreadcrumb(crumb)
-	}
+	CurrentHub().AddBreadcrumb(crumb)
 }
 
-// Flush flushes pending events.
-func Flush() {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
+// Flush flushes pending events and reports whether every event was delivered.
+func Flush() bool {
+	return CurrentHub().Flush()
+}
 
-	if client != nil {
-		client.Flush()
-	}
+// FlushWithTimeout flushes pending events and reports whether every event was
+// delivered within the timeout.
+func FlushWithTimeout(timeout time.Duration) bool {
+	return CurrentHub().FlushWithTimeout(timeout)
 }
 
 // Close closes the SDK and flushes pending events.
+// The SDK can be initialized again with Init afterwards.
 func Close() {
 	globalMu.Lock()
-	defer globalMu.Unlock()
+	client := globalHub.Client()
+	globalHub = NewHub(nil, NewScope())
+	globalMu.Unlock()
 
-	if globalClient != nil {
-		globalClient.Close()
-		globalClient = nil
+	if client != nil {
+		client.Close()
 	}
 }
 
+// IsEnabled reports whether the SDK is initialized and capturing events.
+func IsEnabled() bool {
+	client := GetClient()
+	return client != nil && client.IsEnabled()
+}
+
 // GetClient returns the current client instance.
 func GetClient() *Client {
-	globalMu.RLock()
-	defer globalMu.RUnlock()
-	return globalClient
+	return CurrentHub().Client()
 }
 
 // Recover captures any panic that occurs and re-panics.
 // Use this in a deferred function call.
 func Recover() {
 	if r := recover(); r != nil {
-		var err error
-		switch v := r.(type) {
-		case error:
-			err = v
-		case string:
-			err = errors.New(v)
-		default:
-			err = fmt.Errorf("%v", v)
-		}
-
-		CaptureException(err)
+		CurrentHub().CapturePanic(r)
 		Flush()
 		panic(r)
 	}
 }
 
+// RecoverAndCapture captures any panic that occurs without re-panicking, so
+// the program keeps running. Use this in a deferred function call.
+func RecoverAndCapture() {
+	if r := recover(); r != nil {
+		CurrentHub().CapturePanic(r)
+	}
+}
+
 // RecoverWithContext captures any panic with additional context.
 func RecoverWithContext(ctx map[string]interface{}) {
 	if r := recover(); r != nil {
-		var err error
-		switch v := r.(type) {
-		case error:
-			err = v
-		case string:
-			err = errors.New(v)
-		default:
-			err = fmt.Errorf("%v", v)
-		}
-
-		CaptureExceptionWithContext(err, ctx)
+		CurrentHub().capturePanic(r, ctx, nil)
 		Flush()
 		panic(r)
 	}
@@ -300,26 +295,13 @@ func RecoverWithContext(ctx map[string]interface{}) {
 
 // CurrentScope returns a new scope that can be modified independently.
 func CurrentScope() *Scope {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
-
-	if client == nil {
-		return NewScope()
-	}
-	return client.scope.Clone()
+	return CurrentHub().Scope().Clone()
 }
 
-// WithScope executes a function with a new scope.
+// WithScope executes a function with a new scope pushed on the current hub.
+// Events captured inside f carry the data set on the scope.
 func WithScope(f func(*Scope)) {
-	globalMu.RLock()
-	client := globalClient
-	globalMu.RUnlock()
-
-	if client != nil {
-		scope := client.scope.Clone()
-		f(scope)
-	}
+	CurrentHub().WithScope(f)
 }
 
 // getHostname returns the hostname of the current machine.
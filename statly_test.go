@@ -1,7 +1,14 @@
 package statly
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -28,10 +35,11 @@ func (t *MockTransport) Send(event *Event) bool {
 	return true
 }
 
-func (t *MockTransport) Flush(timeout time.Duration) {
+func (t *MockTransport) Flush(timeout time.Duration) bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.flushed = true
+	return true
 }
 
 func (t *MockTransport) Close(timeout time.Duration) {
@@ -77,6 +85,57 @@ func TestClientInitMissingDSN(t *testing.T) {
 	}
 }
 
+func TestClientInitInvalidDSN(t *testing.T) {
+	for _, dsn := range []string{
+		"statly.live/test",
+		"ftp://sk_test_xxx@statly.live/test",
+		"https://statly.live/test",
+		"https://sk_test_xxx@/test",
+		"https://sk_test_xxx@statly.live",
+		"https://sk_test_xxx@statly.live:/test",
+	} {
+		if _, err := NewClient(Options{DSN: dsn}); !errors.Is(err, ErrInvalidDSN) {
+			t.Errorf("Expected ErrInvalidDSN for %q, got %v", dsn, err)
+		}
+	}
+
+	_, err := NewClient(Options{
+		DSN:          "https://sk_test_xxx@statly.live/test",
+		Destinations: []Destination{{DSN: "https://statly.live/other"}},
+	})
+	if !errors.Is(err, ErrInvalidDSN) {
+		t.Errorf("Expected ErrInvalidDSN for destination, got %v", err)
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	dsn, err := ParseDSN("http://sk_test_xxx@localhost:8080/statly/my-org/?region=eu")
+	if err != nil {
+		t.Fatalf("ParseDSN failed: %v", err)
+	}
+
+	if dsn.Scheme != "http" || dsn.Key != "sk_test_xxx" || dsn.Host != "localhost:8080" {
+		t.Errorf("Unexpected scheme, key or host: %+v", dsn)
+	}
+	if dsn.PathPrefix != "/statly" || dsn.Org != "my-org" {
+		t.Errorf("Expected prefix /statly and org my-org, got %q and %q", dsn.PathPrefix, dsn.Org)
+	}
+	if dsn.Query.Get("region") != "eu" {
+		t.Errorf("Expected region option, got %v", dsn.Query)
+	}
+	if got := dsn.IngestURL(); got != "http://localhost:8080/statly/api/v1/observe/ingest" {
+		t.Errorf("Unexpected ingest URL %s", got)
+	}
+
+	dsn, _ = ParseDSN("https://sk_live_xxx@statly.live/your-org")
+	if got := dsn.IngestURL(); got != "https://statly.live/api/v1/observe/ingest" {
+		t.Errorf("Unexpected ingest URL %s", got)
+	}
+	if got := dsn.String(); got != "https://sk_live_xxx@statly.live/your-org" {
+		t.Errorf("Expected DSN to round trip, got %s", got)
+	}
+}
+
 func TestCaptureException(t *testing.T) {
 	transport := NewMockTransport()
 
@@ -258,7 +317,7 @@ func TestBeforeSend(t *testing.T) {
 	client, _ := NewClient(Options{
 		DSN:       "https://sk_test_xxx@statly.live/test",
 		Transport: transport,
-		BeforeSend: func(event *Event) *Event {
+		BeforeSend: func(event *Event, hint *EventHint) *Event {
 			event.Tags["custom"] = "added"
 			return event
 		},
@@ -282,7 +341,7 @@ func TestBeforeSendDropEvent(t *testing.T) {
 	client, _ := NewClient(Options{
 		DSN:       "https://sk_test_xxx@statly.live/test",
 		Transport: transport,
-		BeforeSend: func(event *Event) *Event {
+		BeforeSend: func(event *Event, hint *EventHint) *Event {
 			return nil // Drop all events
 		},
 	})
@@ -386,3 +445,1495 @@ func TestMaxBreadcrumbs(t *testing.T) {
 		t.Errorf("Expected 5 breadcrumbs, got %d", len(scope.breadcrumbs))
 	}
 }
+
+func TestHubPushPopScope(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	hub := NewHub(client, NewScope())
+	hub.SetTag("outer", "yes")
+
+	scope := hub.PushScope()
+	scope.SetTag("inner", "yes")
+	hub.CaptureMessage("pushed", LevelInfo)
+
+	hub.PopScope()
+	hub.CaptureMessage("popped", LevelInfo)
+
+	events := transport.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	if events[0].Tags["outer"] != "yes" || events[0].Tags["inner"] != "yes" {
+		t.Errorf("Expected pushed scope tags on first event, got %v", events[0].Tags)
+	}
+
+	if _, ok := events[1].Tags["inner"]; ok {
+		t.Errorf("Expected inner tag to be gone after PopScope")
+	}
+
+	// Popping the root scope is a no-op
+	hub.PopScope()
+	hub.PopScope()
+	if hub.Scope() == nil {
+		t.Errorf("Expected root scope to remain")
+	}
+}
+
+func TestHubCloneIsolation(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	root := NewHub(client, NewScope())
+	root.SetTag("shared", "value")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hub := root.Clone()
+			hub.SetTag("request", string(rune('a'+i)))
+			hub.CaptureMessage(string(rune('a'+i)), LevelInfo)
+		}(i)
+	}
+	wg.Wait()
+
+	events := transport.Events()
+	if len(events) != 10 {
+		t.Fatalf("Expected 10 events, got %d", len(events))
+	}
+
+	for _, event := range events {
+		if event.Tags["request"] != event.Message {
+			t.Errorf("Expected request tag %q, got %q", event.Message, event.Tags["request"])
+		}
+		if event.Tags["shared"] != "value" {
+			t.Errorf("Expected shared tag to be inherited")
+		}
+	}
+
+	if _, ok := root.Scope().tags["request"]; ok {
+		t.Errorf("Root hub scope should not be affected by clones")
+	}
+}
+
+func TestGlobalHubDelegation(t *testing.T) {
+	transport := NewMockTransport()
+
+	err := Init(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	defer Close()
+
+	if err := Init(Options{DSN: "https://sk_test_xxx@statly.live/test"}); err != ErrAlreadyInitialized {
+		t.Errorf("Expected ErrAlreadyInitialized, got %v", err)
+	}
+
+	SetTag("global", "yes")
+	CaptureMessage("test", LevelInfo)
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	if events[0].Tags["global"] != "yes" {
+		t.Errorf("Expected global tag to be applied")
+	}
+}
+
+func TestContextHub(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	if GetHubFromContext(context.Background()) != nil {
+		t.Errorf("Expected no hub on empty context")
+	}
+
+	hub := NewHub(client, NewScope())
+	ctx := SetHubOnContext(context.Background(), hub)
+
+	if GetHubFromContext(ctx) != hub {
+		t.Fatalf("Expected hub to be stored on context")
+	}
+
+	SetTagCtx(ctx, "request_id", "abc")
+	AddBreadcrumbCtx(ctx, Breadcrumb{Message: "loading order"})
+	CaptureExceptionCtx(ctx, errors.New("not found"))
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	if events[0].Tags["request_id"] != "abc" {
+		t.Errorf("Expected tag from context hub")
+	}
+
+	if len(events[0].Breadcrumbs) != 1 {
+		t.Errorf("Expected breadcrumb from context hub")
+	}
+}
+
+func TestWithScope(t *testing.T) {
+	transport := NewMockTransport()
+
+	err := Init(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	defer Close()
+
+	WithScope(func(scope *Scope) {
+		scope.SetTag("operation", "batch-import")
+		scope.SetUser(User{ID: "batch-user"})
+
+		scope.CaptureMessage("inside", LevelInfo)
+		CaptureMessage("package-level", LevelInfo)
+	})
+
+	CaptureMessage("outside", LevelInfo)
+
+	events := transport.Events()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+
+	for _, event := range events[:2] {
+		if event.Tags["operation"] != "batch-import" {
+			t.Errorf("Expected scoped tag on %q captured inside WithScope", event.Message)
+		}
+		if event.User == nil || event.User.ID != "batch-user" {
+			t.Errorf("Expected scoped user on %q captured inside WithScope", event.Message)
+		}
+	}
+
+	if _, ok := events[2].Tags["operation"]; ok {
+		t.Errorf("Expected scoped tag to be discarded after WithScope")
+	}
+
+	if events[2].User != nil {
+		t.Errorf("Expected scoped user to be discarded after WithScope")
+	}
+}
+
+func TestWithScopeConcurrent(t *testing.T) {
+	transport := NewMockTransport()
+
+	err := Init(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	defer Close()
+
+	// Interleave the scopes: each sets its tag, waits for the other, then
+	// captures
+	var ready, set sync.WaitGroup
+	ready.Add(2)
+	set.Add(2)
+	for _, name := range []string{"A", "B"} {
+		go func(name string) {
+			defer ready.Done()
+			WithScope(func(scope *Scope) {
+				scope.SetTag("request", name)
+				set.Done()
+				set.Wait()
+				scope.CaptureMessage(name, LevelInfo)
+			})
+		}(name)
+	}
+	ready.Wait()
+
+	events := transport.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	for _, event := range events {
+		if event.Tags["request"] != event.Message {
+			t.Errorf("Expected tag %q on message %q, got %q", event.Message, event.Message, event.Tags["request"])
+		}
+	}
+
+	CaptureMessage("outside", LevelInfo)
+	if _, ok := transport.Events()[2].Tags["request"]; ok {
+		t.Errorf("Expected WithScope not to modify the global scope")
+	}
+}
+
+func TestScopeCaptureOutsideWithScope(t *testing.T) {
+	transport := NewMockTransport()
+
+	err := Init(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	defer Close()
+
+	pushed := CurrentHub().PushScope()
+	pushed.SetTag("scope", "pushed")
+	pushed.CaptureMessage("pushed", LevelInfo)
+	CurrentHub().PopScope()
+
+	current := CurrentScope()
+	current.SetTag("scope", "current")
+	current.CaptureException(errors.New("current"))
+
+	events := transport.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected both scopes to capture, got %d events", len(events))
+	}
+	if events[0].Tags["scope"] != "pushed" || events[1].Tags["scope"] != "current" {
+		t.Errorf("Expected the data of each scope, got %q and %q", events[0].Tags["scope"], events[1].Tags["scope"])
+	}
+}
+
+func TestScopeTransactionFingerprintLevel(t *testing.T) {
+	scope := NewScope()
+	scope.SetTransaction("GET /orders/:id")
+	scope.SetFingerprint([]string{"orders", "not-found"})
+	scope.SetLevel(LevelWarning)
+
+	event := NewMessageEvent("test", LevelError)
+	scope.ApplyToEvent(event)
+
+	if event.Transaction != "GET /orders/:id" {
+		t.Errorf("Expected transaction to be applied, got %q", event.Transaction)
+	}
+
+	if len(event.Fingerprint) != 2 || event.Fingerprint[0] != "orders" {
+		t.Errorf("Expected fingerprint to be applied, got %v", event.Fingerprint)
+	}
+
+	if event.Level != LevelWarning {
+		t.Errorf("Expected level override to be applied, got %q", event.Level)
+	}
+
+	cloned := scope.Clone()
+	if cloned.level != LevelWarning {
+		t.Errorf("Expected cloned level to be warning")
+	}
+
+	scope.Clear()
+	if scope.level != "" || scope.transaction != "" || scope.fingerprint != nil {
+		t.Errorf("Expected level, transaction and fingerprint to be cleared")
+	}
+}
+
+func TestScopeDefaultFingerprint(t *testing.T) {
+	scope := NewScope()
+	scope.SetFingerprint([]string{DefaultFingerprint, "stripe"})
+
+	event := NewMessageEvent("test", LevelError)
+	scope.ApplyToEvent(event)
+
+	if len(event.Fingerprint) != 2 || event.Fingerprint[0] != DefaultFingerprint {
+		t.Errorf("Expected placeholder to be kept without a fingerprint, got %v", event.Fingerprint)
+	}
+
+	event = NewMessageEvent("test", LevelError)
+	event.Fingerprint = []string{"payment", "declined"}
+	scope.ApplyToEvent(event)
+
+	expected := []string{"payment", "declined", "stripe"}
+	if len(event.Fingerprint) != len(expected) {
+		t.Fatalf("Expected fingerprint %v, got %v", expected, event.Fingerprint)
+	}
+	for i := range expected {
+		if event.Fingerprint[i] != expected[i] {
+			t.Errorf("Expected fingerprint %v, got %v", expected, event.Fingerprint)
+		}
+	}
+}
+
+func TestEventProcessors(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	var order []string
+
+	AddGlobalEventProcessor(func(event *Event, hint *EventHint) *Event {
+		order = append(order, "global")
+		return event
+	})
+	defer func() {
+		globalEventProcessors = nil
+	}()
+
+	client.AddEventProcessor(func(event *Event, hint *EventHint) *Event {
+		order = append(order, "client")
+		event.Tags["library"] = "billing"
+		return event
+	})
+
+	scope := NewScope()
+	scope.AddEventProcessor(func(event *Event, hint *EventHint) *Event {
+		order = append(order, "scope")
+		if event.Message == "drop me" {
+			return nil
+		}
+		return event
+	})
+
+	hub := NewHub(client, scope)
+	hub.CaptureMessage("keep me", LevelInfo)
+	hub.CaptureMessage("drop me", LevelInfo)
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	if events[0].Tags["library"] != "billing" {
+		t.Errorf("Expected client processor to enrich the event")
+	}
+
+	expected := []string{"global", "client", "scope", "global", "client", "scope"}
+	if len(order) != len(expected) {
+		t.Fatalf("Expected processor order %v, got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Errorf("Expected processor order %v, got %v", expected, order)
+			break
+		}
+	}
+}
+
+func TestBeforeSendHint(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+		BeforeSend: func(event *Event, hint *EventHint) *Event {
+			if errors.Is(hint.OriginalException, context.Canceled) {
+				return nil
+			}
+			return event
+		},
+	})
+
+	client.CaptureException(fmt.Errorf("query failed: %w", context.Canceled))
+	client.CaptureException(errors.New("boom"))
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	if events[0].Exception[0].Value != "boom" {
+		t.Errorf("Expected canceled error to be dropped")
+	}
+}
+
+func TestCaptureExceptionWithHint(t *testing.T) {
+	transport := NewMockTransport()
+
+	var received *EventHint
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+	client.AddEventProcessor(func(event *Event, hint *EventHint) *Event {
+		received = hint
+		return event
+	})
+
+	ctx := SetHubOnContext(context.Background(), NewHub(client, NewScope()))
+	testErr := errors.New("test error")
+	CaptureExceptionCtx(ctx, testErr)
+
+	if received == nil {
+		t.Fatalf("Expected hint to be passed to event processors")
+	}
+
+	if received.OriginalException != testErr {
+		t.Errorf("Expected original exception on hint")
+	}
+
+	if received.Context != ctx {
+		t.Errorf("Expected context on hint")
+	}
+
+	client.CaptureMessageWithHint("test", LevelInfo, &EventHint{Data: map[string]interface{}{"key": "value"}})
+
+	if received.Data["key"] != "value" {
+		t.Errorf("Expected hint data to be passed to event processors")
+	}
+}
+
+type testIntegration struct {
+	setups int
+}
+
+func (ti *testIntegration) Name() string {
+	return "Test"
+}
+
+func (ti *testIntegration) SetupOnce(client *Client) {
+	ti.setups++
+	client.AddEventProcessor(func(event *Event, hint *EventHint) *Event {
+		event.Tags["integration"] = "test"
+		return event
+	})
+}
+
+func TestDefaultIntegrations(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	for _, name := range []string{RuntimeIntegrationName, ModulesIntegrationName, EnvironmentIntegrationName} {
+		if client.Integration(name) == nil {
+			t.Errorf("Expected default integration %q to be installed", name)
+		}
+	}
+
+	client.CaptureMessage("test", LevelInfo)
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	if _, ok := events[0].Contexts["runtime"]; !ok {
+		t.Errorf("Expected runtime context from the runtime integration")
+	}
+}
+
+func TestModulesIntegrationCopiesModules(t *testing.T) {
+	transport := NewMockTransport()
+
+	modules := &modulesIntegration{}
+	modules.once.Do(func() {
+		modules.modules = map[string]string{"example.com/dep": "v1.0.0"}
+	})
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+		Integrations: func(defaults []Integration) []Integration {
+			return append(WithoutIntegrations(ModulesIntegrationName)(defaults), modules)
+		},
+		BeforeSend: func(event *Event, hint *EventHint) *Event {
+			if event.Message == "first" {
+				event.Modules["example.com/dep"] = "changed"
+			}
+			return event
+		},
+	})
+
+	client.CaptureMessage("first", LevelInfo)
+	client.CaptureMessage("second", LevelInfo)
+
+	events := transport.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if got := events[1].Modules["example.com/dep"]; got != "v1.0.0" {
+		t.Errorf("Expected changes to one event's modules not to leak, got %q", got)
+	}
+}
+
+func TestCustomIntegrations(t *testing.T) {
+	transport := NewMockTransport()
+	integration := &testIntegration{}
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+		Integrations: func(defaults []Integration) []Integration {
+			defaults = WithoutIntegrations(RuntimeIntegrationName)(defaults)
+			return append(defaults, integration, integration)
+		},
+	})
+
+	if integration.setups != 1 {
+		t.Errorf("Expected integration to be set up once, got %d", integration.setups)
+	}
+
+	if client.Integration(RuntimeIntegrationName) != nil {
+		t.Errorf("Expected runtime integration to be disabled")
+	}
+
+	client.CaptureMessage("test", LevelInfo)
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	if _, ok := events[0].Contexts["runtime"]; ok {
+		t.Errorf("Expected no runtime context with the runtime integration disabled")
+	}
+
+	if events[0].Tags["integration"] != "test" {
+		t.Errorf("Expected custom integration to process events")
+	}
+}
+
+func TestIndependentClients(t *testing.T) {
+	appTransport := NewMockTransport()
+	platformTransport := NewMockTransport()
+
+	app, _ := NewClient(Options{
+		DSN:       "https://sk_test_app@statly.live/app",
+		Transport: appTransport,
+	})
+	platform, _ := NewClient(Options{
+		DSN:       "https://sk_test_platform@statly.live/platform",
+		Transport: platformTransport,
+	})
+
+	app.SetTag("owner", "app")
+	platform.SetTag("owner", "platform")
+
+	platform.WithScope(func(scope *Scope) {
+		scope.SetTag("library", "queue")
+		scope.CaptureMessage("inside", LevelInfo)
+	})
+	app.CaptureMessage("app", LevelInfo)
+	platform.CaptureMessage("outside", LevelInfo)
+
+	appEvents := appTransport.Events()
+	platformEvents := platformTransport.Events()
+
+	if len(appEvents) != 1 || len(platformEvents) != 2 {
+		t.Fatalf("Expected 1 app and 2 platform events, got %d and %d", len(appEvents), len(platformEvents))
+	}
+
+	if appEvents[0].Tags["owner"] != "app" {
+		t.Errorf("Expected app client scope on app events")
+	}
+
+	if platformEvents[0].Tags["library"] != "queue" || platformEvents[0].Tags["owner"] != "platform" {
+		t.Errorf("Expected scoped tags on event captured inside Client.WithScope")
+	}
+
+	if _, ok := platformEvents[1].Tags["library"]; ok {
+		t.Errorf("Expected scoped tag to be discarded after Client.WithScope")
+	}
+}
+
+func TestClientRecover(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("Expected Client.Recover to re-panic, got %v", r)
+			}
+		}()
+		defer client.Recover()
+
+		panic("boom")
+	}()
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	if events[0].Exception[0].Value != "boom" {
+		t.Errorf("Expected panic value to be captured")
+	}
+}
+
+func TestFanoutTransport(t *testing.T) {
+	appTransport := NewMockTransport()
+	platformTransport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_app@statly.live/app",
+		Transport: appTransport,
+		Destinations: []Destination{
+			{
+				Transport: platformTransport,
+				BeforeSend: func(event *Event, hint *EventHint) *Event {
+					if event.Tags["component"] != "platform" {
+						return nil
+					}
+					event.Tags["routed"] = "platform"
+					return event
+				},
+			},
+		},
+	})
+
+	client.CaptureMessage("app only", LevelInfo)
+	client.WithScope(func(scope *Scope) {
+		scope.SetTag("component", "platform")
+		scope.CaptureMessage("both", LevelInfo)
+	})
+
+	if len(appTransport.Events()) != 2 {
+		t.Errorf("Expected 2 events on the primary destination, got %d", len(appTransport.Events()))
+	}
+
+	platformEvents := platformTransport.Events()
+	if len(platformEvents) != 1 {
+		t.Fatalf("Expected 1 event on the platform destination, got %d", len(platformEvents))
+	}
+
+	if platformEvents[0].Message != "both" {
+		t.Errorf("Expected filtered event on the platform destination")
+	}
+
+	if _, ok := appTransport.Events()[1].Tags["routed"]; ok {
+		t.Errorf("Destination BeforeSend should not modify the primary event")
+	}
+
+	client.Close()
+	if !appTransport.closed || !platformTransport.closed {
+		t.Errorf("Expected all destinations to be closed")
+	}
+}
+
+func TestFanoutTransportDeepCopy(t *testing.T) {
+	appTransport := NewMockTransport()
+	platformTransport := NewMockTransport()
+
+	sentinel := errors.New("payment declined")
+	var hintErr error
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_app@statly.live/app",
+		Transport: appTransport,
+		Destinations: []Destination{
+			{
+				Transport: platformTransport,
+				BeforeSend: func(event *Event, hint *EventHint) *Event {
+					hintErr = hint.OriginalException
+					event.Exception[0].Stacktrace.Frames[0].AbsPath = "/redacted"
+					event.Exception[0].Mechanism.Type = "redacted"
+					event.Contexts["runtime"].(map[string]interface{})["os"] = "redacted"
+					event.Extra["order"].(map[string]interface{})["card"] = "redacted"
+					return event
+				},
+			},
+		},
+	})
+	defer client.Close()
+
+	client.CaptureExceptionWithContext(sentinel, map[string]interface{}{
+		"order": map[string]interface{}{"card": "4242"},
+	})
+
+	if hintErr != sentinel {
+		t.Errorf("Expected destination BeforeSend to receive the original error, got %v", hintErr)
+	}
+
+	appEvents := appTransport.Events()
+	if len(appEvents) != 1 || len(platformTransport.Events()) != 1 {
+		t.Fatalf("Expected 1 event on each destination")
+	}
+
+	event := appEvents[0]
+	if event.Exception[0].Stacktrace.Frames[0].AbsPath == "/redacted" {
+		t.Errorf("Destination BeforeSend modified the primary stack trace")
+	}
+	if event.Exception[0].Mechanism.Type == "redacted" {
+		t.Errorf("Destination BeforeSend modified the primary mechanism")
+	}
+	if event.Contexts["runtime"].(map[string]interface{})["os"] == "redacted" {
+		t.Errorf("Destination BeforeSend modified the primary contexts")
+	}
+	if event.Extra["order"].(map[string]interface{})["card"] != "4242" {
+		t.Errorf("Destination BeforeSend modified the primary extra data")
+	}
+}
+
+func TestClientInitInvalidDestination(t *testing.T) {
+	_, err := NewClient(Options{
+		DSN:          "https://sk_test_xxx@statly.live/test",
+		Destinations: []Destination{{}},
+	})
+	if err != ErrInvalidDestination {
+		t.Errorf("Expected ErrInvalidDestination, got %v", err)
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:          "https://sk_test_xxx@statly.live/test",
+		Transport:    transport,
+		DedupeWindow: time.Hour,
+	})
+
+	for i := 0; i < 5; i++ {
+		client.CaptureException(errors.New("connection refused"))
+	}
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	client.Flush()
+
+	events = transport.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected a summary event on flush, got %d events", len(events))
+	}
+
+	dedupe, ok := events[1].Contexts["deduplication"].(map[string]interface{})
+	if !ok || dedupe["suppressed"] != 4 {
+		t.Errorf("Expected summary with 4 suppressed events, got %v", events[1].Contexts["deduplication"])
+	}
+
+	// Nothing left to summarize
+	client.Flush()
+	if len(transport.Events()) != 2 {
+		t.Errorf("Expected no further summary events")
+	}
+}
+
+func TestDeduplicationWindow(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:          "https://sk_test_xxx@statly.live/test",
+		Transport:    transport,
+		DedupeWindow: 50 * time.Millisecond,
+	})
+
+	for i := 0; i < 4; i++ {
+		if i == 3 {
+			time.Sleep(60 * time.Millisecond)
+		}
+		client.CaptureException(errors.New("connection refused"))
+	}
+
+	events := transport.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	dedupe, ok := events[1].Contexts["deduplication"].(map[string]interface{})
+	if !ok || dedupe["suppressed"] != 2 {
+		t.Errorf("Expected next event to carry 2 suppressed events, got %v", events[1].Contexts["deduplication"])
+	}
+}
+
+func TestDeduplicationDisabled(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:          "https://sk_test_xxx@statly.live/test",
+		Transport:    transport,
+		DedupeWindow: -1,
+	})
+
+	err := errors.New("connection refused")
+	client.CaptureException(err)
+	client.CaptureException(err)
+
+	if len(transport.Events()) != 2 {
+		t.Errorf("Expected duplicates to be sent with deduplication disabled")
+	}
+
+	// Removing the integration disables deduplication as well
+	transport = NewMockTransport()
+	client, _ = NewClient(Options{
+		DSN:          "https://sk_test_xxx@statly.live/test",
+		Transport:    transport,
+		Integrations: WithoutIntegrations(DedupeIntegrationName),
+	})
+
+	client.CaptureException(err)
+	client.CaptureException(err)
+
+	if len(transport.Events()) != 2 {
+		t.Errorf("Expected duplicates to be sent without the Dedupe integration")
+	}
+}
+
+type driverError struct {
+	code string
+}
+
+func (e *driverError) Error() string {
+	return "driver: " + e.code
+}
+
+func TestErrorChain(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	cause := &driverError{code: "connection reset"}
+	err := fmt.Errorf("repository: %w", fmt.Errorf("query failed: %w", cause))
+	client.CaptureException(err)
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	exceptions := events[0].Exception
+	if len(exceptions) != 3 {
+		t.Fatalf("Expected 3 exceptions, got %d", len(exceptions))
+	}
+
+	if exceptions[0].Value != err.Error() || exceptions[0].Mechanism.ParentID != nil {
+		t.Errorf("Expected captured error first without a parent")
+	}
+
+	if exceptions[2].Type != "*statly.driverError" {
+		t.Errorf("Expected innermost type *statly.driverError, got %s", exceptions[2].Type)
+	}
+
+	for i := 1; i < len(exceptions); i++ {
+		mechanism := exceptions[i].Mechanism
+		if mechanism.ExceptionID != i || mechanism.ParentID == nil || *mechanism.ParentID != i-1 {
+			t.Errorf("Expected exception %d to link to %d, got %+v", i, i-1, mechanism)
+		}
+		if mechanism.Source != "cause" {
+			t.Errorf("Expected source 'cause', got %q", mechanism.Source)
+		}
+	}
+
+	if exceptions[0].Stacktrace == nil {
+		t.Errorf("Expected stack trace on the captured error")
+	}
+}
+
+func TestJoinedErrorChain(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	err := errors.Join(errors.New("first"), fmt.Errorf("second: %w", errors.New("cause")))
+	client.CaptureException(err)
+
+	exceptions := transport.Events()[0].Exception
+	if len(exceptions) != 4 {
+		t.Fatalf("Expected 4 exceptions, got %d", len(exceptions))
+	}
+
+	if !exceptions[0].Mechanism.IsExceptionGroup {
+		t.Errorf("Expected joined error to be an exception group")
+	}
+
+	if exceptions[1].Mechanism.Source != "errors[0]" || exceptions[2].Mechanism.Source != "errors[1]" {
+		t.Errorf("Expected joined branches to be labeled by index")
+	}
+
+	if *exceptions[3].Mechanism.ParentID != 2 {
+		t.Errorf("Expected wrapped cause to link to its wrapper")
+	}
+}
+
+func TestErrorChainDepthLimit(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:           "https://sk_test_xxx@statly.live/test",
+		Transport:     transport,
+		MaxErrorDepth: 2,
+	})
+
+	err := errors.New("root")
+	for i := 0; i < 5; i++ {
+		err = fmt.Errorf("layer %d: %w", i, err)
+	}
+	client.CaptureException(err)
+
+	if n := len(transport.Events()[0].Exception); n != 3 {
+		t.Errorf("Expected 3 exceptions with a depth limit of 2, got %d", n)
+	}
+}
+
+func TestSourceReaderCache(t *testing.T) {
+	dir := t.TempDir()
+	paths := make([]string, 3)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("file%d.go", i))
+		os.WriteFile(paths[i], []byte("line 1\nline 2\nline 3\n"), 0o644)
+	}
+
+	reader := newSourceReader(2, 1<<20)
+
+	for _, path := range paths {
+		if _, line, _, ok := reader.contextLines(path, 2, 1); !ok || line != "line 2" {
+			t.Errorf("Expected line 2 of %s, got %q", path, line)
+		}
+	}
+
+	if reader.order.Len() != 2 {
+		t.Errorf("Expected cache to hold 2 files, got %d", reader.order.Len())
+	}
+
+	if _, ok := reader.files[paths[0]]; ok {
+		t.Errorf("Expected least recently used file to be evicted")
+	}
+
+	if _, _, _, ok := reader.contextLines(paths[0], 10, 1); ok {
+		t.Errorf("Expected lines past the end of the file to be unavailable")
+	}
+
+	large := newSourceReader(2, 4)
+	if _, _, _, ok := large.contextLines(paths[1], 1, 1); ok {
+		t.Errorf("Expected files over the size limit to be skipped")
+	}
+}
+
+func TestSplitFunctionName(t *testing.T) {
+	tests := []struct {
+		name, module, function string
+	}{
+		{"github.com/gin-gonic/gin.(*Context).Next", "github.com/gin-gonic/gin", "(*Context).Next"},
+		{"log/slog.(*Logger).Error", "log/slog", "(*Logger).Error"},
+		{"main.main.func1", "main", "main.func1"},
+		{"gopkg.in/yaml%2ev3.Unmarshal", "gopkg.in/yaml.v3", "Unmarshal"},
+		{"errors.New", "errors", "New"},
+	}
+
+	for _, tt := range tests {
+		module, function := splitFunctionName(tt.name)
+		if module != tt.module || function != tt.function {
+			t.Errorf("splitFunctionName(%q) = %q, %q; want %q, %q", tt.name, module, function, tt.module, tt.function)
+		}
+	}
+}
+
+func TestInAppResolver(t *testing.T) {
+	resolver := &inAppResolver{
+		include:    []string{"github.com/acme/shared"},
+		exclude:    []string{"example.com/app/vendor"},
+		mainModule: "example.com/app",
+	}
+
+	tests := []struct {
+		module string
+		inApp  bool
+	}{
+		{"example.com/app", true},
+		{"example.com/app/orders", true},
+		{"example.com/app/orders_test", true},
+		{"example.com/application", false},
+		{"example.com/app/vendor/lib", false},
+		{"github.com/acme/shared/db", true},
+		{"github.com/gin-gonic/gin", false},
+		{"log/slog", false},
+		{"errors", false},
+		{"main", true},
+	}
+
+	for _, tt := range tests {
+		if got := resolver.isInApp(tt.module); got != tt.inApp {
+			t.Errorf("isInApp(%q) = %v; want %v", tt.module, got, tt.inApp)
+		}
+	}
+
+	unknown := &inAppResolver{}
+	if !unknown.isInApp("github.com/gin-gonic/gin") || unknown.isInApp("net/http") {
+		t.Errorf("Expected non-standard packages to be in-app without a main module")
+	}
+}
+
+func TestInAppOptions(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:          "https://sk_test_xxx@statly.live/test",
+		Transport:    transport,
+		InAppExclude: []string{"github.com/KodyDennon/statly-go"},
+	})
+
+	client.CaptureException(errors.New("test error"))
+
+	for _, frame := range transport.Events()[0].Exception[0].Stacktrace.Frames {
+		if frame.InApp {
+			t.Errorf("Expected excluded frame %s.%s not to be in-app", frame.Module, frame.Function)
+		}
+	}
+}
+
+func TestRelativeFilename(t *testing.T) {
+	resolver := &inAppResolver{mainModule: "example.com/app", mainPackage: "example.com/app/cmd/server"}
+
+	tests := []struct {
+		module string
+		file   string
+		want   string
+	}{
+		{"example.com/app", "/home/dev/app/main.go", "main.go"},
+		{"example.com/app/orders", "/home/dev/app/orders/repo.go", "orders/repo.go"},
+		{"example.com/app/orders_test", "/home/dev/app/orders/repo_test.go", "orders/repo_test.go"},
+		{"main", "/src/app/cmd/server/main.go", "cmd/server/main.go"},
+		{"net/http", "/usr/local/go/src/net/http/server.go", "net/http/server.go"},
+		{"github.com/gin-gonic/gin", "/home/dev/go/pkg/mod/github.com/gin-gonic/gin@v1.9.1/context.go", "github.com/gin-gonic/gin@v1.9.1/context.go"},
+		{"github.com/acme/lib", "/home/dev/go/src/github.com/acme/lib/lib.go", "github.com/acme/lib/lib.go"},
+		{"example.com/app/orders", "example.com/app/orders/repo.go", "example.com/app/orders/repo.go"},
+		{"github.com/acme/lib", "/opt/lib.go", "/opt/lib.go"},
+	}
+
+	for _, tt := range tests {
+		if got := resolver.relativeFilename(tt.module, tt.file); got != tt.want {
+			t.Errorf("relativeFilename(%q, %q) = %q; want %q", tt.module, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestGo(t *testing.T) {
+	transport := NewMockTransport()
+	sent := make(chan *Event, 1)
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+		BeforeSend: func(event *Event, hint *EventHint) *Event {
+			sent <- event.clone()
+			return event
+		},
+	})
+
+	ctx := SetHubOnContext(context.Background(), client.Hub())
+	GoWithOptions(ctx, GoOptions{Name: "worker"}, func(ctx context.Context) {
+		SetTagCtx(ctx, "job", "import")
+		panic("worker failed")
+	})
+
+	select {
+	case event := <-sent:
+		if event.Exception[0].Mechanism.Type != MechanismPanic {
+			t.Errorf("Expected panic mechanism, got %s", event.Exception[0].Mechanism.Type)
+		}
+		if event.Tags["job"] != "import" {
+			t.Errorf("Expected tag set inside the goroutine")
+		}
+		goroutine, _ := event.Contexts["goroutine"].(map[string]interface{})
+		if goroutine["name"] != "worker" || !strings.HasSuffix(goroutine["created_by"].(string), "TestGo") {
+			t.Errorf("Expected goroutine metadata, got %v", goroutine)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected panic in goroutine to be captured")
+	}
+
+	if _, ok := client.Hub().Scope().tags["job"]; ok {
+		t.Errorf("Expected goroutine scope to be isolated from the parent hub")
+	}
+}
+
+func TestRecoverAndCapture(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	func() {
+		defer client.RecoverAndCapture()
+		panic("recovered")
+	}()
+
+	if len(transport.Events()) != 1 {
+		t.Errorf("Expected panic to be captured without re-panicking")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	failure := errors.New("worker failed")
+	group, ctx := NewGroup(SetHubOnContext(context.Background(), client.Hub()))
+
+	group.Go(func(ctx context.Context) error {
+		return failure
+	})
+	group.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		panic("after cancel")
+	})
+	group.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := group.Wait(); err != failure {
+		t.Errorf("Expected first error from Wait, got %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Errorf("Expected group context to be canceled")
+	}
+
+	events := transport.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected error and panic to be captured, got %d events", len(events))
+	}
+
+	mechanisms := map[string]bool{}
+	for _, event := range events {
+		mechanisms[event.Exception[0].Mechanism.Type] = true
+	}
+	if !mechanisms["generic"] || !mechanisms[MechanismPanic] {
+		t.Errorf("Expected generic and panic events, got %v", mechanisms)
+	}
+}
+
+func TestGroupPanicError(t *testing.T) {
+	var group Group
+
+	group.Go(func(ctx context.Context) error {
+		panic(errors.New("boom"))
+	})
+
+	err := group.Wait()
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || err.Error() != "panic: boom" {
+		t.Errorf("Expected PanicError, got %v", err)
+	}
+}
+
+func TestEventLimits(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:            "https://sk_test_xxx@statly.live/test",
+		Transport:      transport,
+		MaxBreadcrumbs: 5,
+		Limits: EventLimits{
+			MaxStringLength: 16,
+			MaxBreadth:      3,
+			MaxDepth:        2,
+		},
+		BeforeSend: func(event *Event, hint *EventHint) *Event {
+			for i := 0; i < 10; i++ {
+				event.Breadcrumbs = append(event.Breadcrumbs, BreadcrumbValue{Message: fmt.Sprint(i)})
+			}
+			return event
+		},
+	})
+
+	items := []int{1, 2, 3, 4, 5}
+	client.CaptureMessageWithContext("a message longer than the limit", LevelInfo, map[string]interface{}{
+		"items":  items,
+		"nested": map[string]interface{}{"inner": map[string]interface{}{"deep": true}},
+		"name":   "short",
+	})
+
+	event := transport.Events()[0]
+
+	if len(event.Message) != 16 || !strings.HasSuffix(event.Message, "...") {
+		t.Errorf("Expected message trimmed to 16 bytes, got %q", event.Message)
+	}
+	if len(event.Extra["items"].([]interface{})) != 3 || len(items) != 5 {
+		t.Errorf("Expected a trimmed copy of the slice, got %v", event.Extra["items"])
+	}
+	if inner := event.Extra["nested"].(map[string]interface{})["inner"]; inner != nil {
+		t.Errorf("Expected value beyond the depth limit to be removed, got %v", inner)
+	}
+	if len(event.Breadcrumbs) != 5 || event.Breadcrumbs[4].Message != "9" {
+		t.Errorf("Expected the 5 newest breadcrumbs, got %d", len(event.Breadcrumbs))
+	}
+
+	expected := map[string]TrimmedValue{
+		"message":            {Reason: TrimReasonLength, Length: 31},
+		"extra.items":        {Reason: TrimReasonBreadth, Length: 5},
+		"extra.nested.inner": {Reason: TrimReasonDepth, Length: 1},
+		"breadcrumbs":        {Reason: TrimReasonCount, Length: 10},
+	}
+	for path, want := range expected {
+		if got := event.Meta[path]; got != want {
+			t.Errorf("Expected meta %s = %+v, got %+v", path, want, got)
+		}
+	}
+}
+
+func TestEventSizeLimit(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+		Limits:    EventLimits{MaxEventSize: 4096},
+	})
+
+	for i := 0; i < 20; i++ {
+		client.AddBreadcrumb(Breadcrumb{Message: strings.Repeat("b", 100)})
+	}
+	client.CaptureExceptionWithContext(errors.New("too large"), map[string]interface{}{
+		"payload": strings.Repeat("x", 5000),
+		"small":   "kept",
+	})
+
+	event := transport.Events()[0]
+
+	data, _ := json.Marshal(event)
+	if len(data) > 4096 {
+		t.Errorf("Expected event to fit 4096 bytes, got %d", len(data))
+	}
+	if len(event.Breadcrumbs) != 0 || event.Meta["breadcrumbs"].Reason != TrimReasonSize {
+		t.Errorf("Expected breadcrumbs to be dropped first, got %d", len(event.Breadcrumbs))
+	}
+	if _, ok := event.Extra["payload"]; ok || event.Meta["extra.payload"].Reason != TrimReasonSize {
+		t.Errorf("Expected largest extra value to be dropped")
+	}
+	if event.Extra["small"] != "kept" {
+		t.Errorf("Expected small extra value to be kept")
+	}
+}
+
+func TestEventSizeLimitStackTrace(t *testing.T) {
+	transport := NewMockTransport()
+
+	frames := make([]StackFrame, 500)
+	for i := range frames {
+		frames[i] = StackFrame{
+			Filename: fmt.Sprintf("handlers/frame_%d.go", i),
+			Function: fmt.Sprintf("handler%d", i),
+			Lineno:   i + 1,
+		}
+	}
+	tags := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		tags[fmt.Sprintf("tag%03d", i)] = "value"
+	}
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+		Limits:    EventLimits{MaxEventSize: 4096},
+		BeforeSend: func(event *Event, hint *EventHint) *Event {
+			event.Tags = tags
+			event.Exception[0].Stacktrace = &Stacktrace{Frames: frames}
+			return event
+		},
+	})
+
+	client.CaptureException(errors.New("deep recursion"))
+
+	events := transport.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	event := events[0]
+
+	data, _ := json.Marshal(event)
+	if len(data) > 4096 {
+		t.Errorf("Expected event to fit 4096 bytes, got %d", len(data))
+	}
+	if len(event.Tags) > DefaultMaxBreadth || event.Meta["tags"].Reason == "" {
+		t.Errorf("Expected tags to be capped, got %d", len(event.Tags))
+	}
+
+	st := event.Exception[0].Stacktrace
+	if len(st.Frames) == 0 || len(st.Frames) >= 500 {
+		t.Fatalf("Expected frames to be removed from the middle, got %d", len(st.Frames))
+	}
+	if st.Frames[0].Function != "handler0" || st.Frames[len(st.Frames)-1].Function != "handler499" {
+		t.Errorf("Expected outermost and innermost frames to be kept, got %s and %s",
+			st.Frames[0].Function, st.Frames[len(st.Frames)-1].Function)
+	}
+	if len(st.FramesOmitted) != 2 || st.FramesOmitted[1]-st.FramesOmitted[0] != 500-len(st.Frames) {
+		t.Errorf("Expected omitted frames to be recorded, got %v", st.FramesOmitted)
+	}
+	if got := event.Meta["exception.0.stacktrace.frames"]; got.Reason != TrimReasonSize || got.Length != 500 {
+		t.Errorf("Expected removed frames in _meta, got %+v", got)
+	}
+}
+
+type cyclicNode struct {
+	Name string      `json:"name"`
+	Next *cyclicNode `json:"next,omitempty"`
+}
+
+type panickingMarshaler struct{}
+
+func (panickingMarshaler) MarshalJSON() ([]byte, error) {
+	panic("marshal failed")
+}
+
+type temperature float64
+
+func (t temperature) String() string {
+	return fmt.Sprintf("%.1f°C", float64(t))
+}
+
+type embeddedInfo struct {
+	Region string
+}
+
+type unserializable struct {
+	embeddedInfo
+	ID       int    `json:"id"`
+	Secret   string `json:"-"`
+	Empty    string `json:"empty,omitempty"`
+	internal int
+}
+
+func TestNormalizeExtra(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	node := &cyclicNode{Name: "a"}
+	node.Next = &cyclicNode{Name: "b", Next: node}
+
+	client.CaptureMessageWithContext("test", LevelInfo, map[string]interface{}{
+		"channel":   make(chan int),
+		"func":      func() {},
+		"cycle":     node,
+		"marshaler": panickingMarshaler{},
+		"nan":       math.NaN(),
+		"error":     errors.New("failed"),
+		"stringer":  temperature(21.5),
+		"struct":    unserializable{embeddedInfo{"eu"}, 7, "hidden", "", 1},
+		"time":      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+
+	event := transport.Events()[0]
+	if _, err := json.Marshal(event); err != nil {
+		t.Fatalf("Expected normalized event to serialize, got %v", err)
+	}
+
+	extra := event.Extra
+	expected := map[string]interface{}{
+		"channel":   "<chan int>",
+		"func":      "<func()>",
+		"marshaler": "<statly.panickingMarshaler: panic: marshal failed>",
+		"nan":       "NaN",
+		"error":     "failed",
+		"stringer":  "21.5°C",
+		"time":      "2024-01-02T03:04:05Z",
+	}
+	for key, want := range expected {
+		if extra[key] != want {
+			t.Errorf("Expected extra %s = %v, got %v", key, want, extra[key])
+		}
+	}
+
+	next := extra["cycle"].(map[string]interface{})["next"].(map[string]interface{})
+	if next["next"] != "<cycle *statly.cyclicNode>" {
+		t.Errorf("Expected cycle to be broken, got %v", next["next"])
+	}
+
+	fields := extra["struct"].(map[string]interface{})
+	if len(fields) != 2 || fields["id"] != int64(7) || fields["Region"] != "eu" {
+		t.Errorf("Expected exported and promoted struct fields, got %v", fields)
+	}
+}
+
+type orderError struct {
+	orderID string
+}
+
+func (e *orderError) Error() string {
+	return "order " + e.orderID + " failed"
+}
+
+func (e *orderError) StatlyContext() map[string]interface{} {
+	return map[string]interface{}{"order_id": e.orderID, "code": "ORDER_FAILED"}
+}
+
+func (e *orderError) StatlyTags() map[string]string {
+	return map[string]string{"component": "orders", "retryable": "false"}
+}
+
+func (e *orderError) StatlyFingerprint() []string {
+	return []string{"order-failure"}
+}
+
+type codedError struct {
+	error
+	code string
+}
+
+func (e *codedError) Unwrap() error {
+	return e.error
+}
+
+func (e *codedError) StatlyContext() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+func (e *codedError) StatlyTags() map[string]string {
+	return map[string]string{"retryable": "true"}
+}
+
+func TestErrorAttributes(t *testing.T) {
+	transport := NewMockTransport()
+
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+
+	client.SetTag("component", "api")
+
+	err := &codedError{fmt.Errorf("checkout: %w", &orderError{orderID: "o-42"}), "CHECKOUT_FAILED"}
+	client.CaptureException(err)
+
+	event := transport.Events()[0]
+
+	errorContext, _ := event.Contexts["error"].(map[string]interface{})
+	if errorContext["order_id"] != "o-42" || errorContext["code"] != "CHECKOUT_FAILED" {
+		t.Errorf("Expected error context merged from the chain, got %v", errorContext)
+	}
+	if event.Tags["retryable"] != "true" {
+		t.Errorf("Expected outer error tag to take precedence, got %s", event.Tags["retryable"])
+	}
+	if event.Tags["component"] != "api" {
+		t.Errorf("Expected scope tag to take precedence, got %s", event.Tags["component"])
+	}
+	if len(event.Fingerprint) != 1 || event.Fingerprint[0] != "order-failure" {
+		t.Errorf("Expected fingerprint from wrapped error, got %v", event.Fingerprint)
+	}
+}
@@ -2,19 +2,23 @@ package statly
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Transport defines the interface for sending events.
+//
+// Flush reports whether every queued event was delivered before the timeout.
+// Close must be safe to call more than once.
 type Transport interface {
 	Send(event *Event) bool
-	Flush(timeout time.Duration)
+	Flush(timeout time.Duration) bool
 	Close(timeout time.Duration)
 }
 
@@ -27,21 +31,57 @@ type TransportOptions struct {
 	BatchSize   int
 	FlushPeriod time.Duration
 	Debug       bool
+
+	// SpoolDir enables a disk spool in the given directory. Events and
+	// envelopes that cannot be delivered because Statly is unreachable, or
+	// that do not fit the queue, are written to the spool and sent once
+	// Statly is reachable again, including by later processes using the same
+	// directory.
+	SpoolDir string
+
+	// SpoolMaxSize is the maximum size of the spool in bytes. The oldest
+	// events are dropped when it is exceeded.
+	SpoolMaxSize int64
+
+	// SpoolMaxAge is the maximum age of spooled events.
+	SpoolMaxAge time.Duration
+
+	// Compressor compresses request bodies, e.g. GzipCompressor{}. Bodies
+	// are sent uncompressed when it is nil.
+	Compressor Compressor
+
+	// CompressionThreshold is the body size in bytes below which bodies are
+	// not compressed. Defaults to DefaultCompressionThreshold; a negative
+	// value compresses every body.
+	CompressionThreshold int
 }
 
 // HTTPTransport sends events over HTTP with batching and retry support.
 type HTTPTransport struct {
-	options  TransportOptions
-	dsn      string
-	endpoint string
-	client   *http.Client
-	queue    chan *Event
-	wg       sync.WaitGroup
-	done     chan struct{}
-	mu       sync.Mutex
+	options          TransportOptions
+	dsn              *DSN
+	endpoint         string
+	envelopeEndpoint string
+	client           *http.Client
+	queue            chan *Event
+	overflow         chan interface{}
+	spooled          chan struct{}
+	envelopes        chan *Envelope
+	flushes          chan chan bool
+	wg               sync.WaitGroup
+	done             chan struct{}
+	spool            *spool
+	limits           *rateLimits
+	closed           bool
+	mu               sync.RWMutex
+
+	// deadline is when Close stops waiting, in Unix nanoseconds, or zero
+	// while the transport is open. Requests do not retry past it.
+	deadline atomic.Int64
 }
 
-// NewHTTPTransport creates a new HTTP transport.
+// NewHTTPTransport creates a new HTTP transport. Events are dropped when the
+// DSN is invalid; NewClient reports invalid DSNs.
 func NewHTTPTransport(options TransportOptions) *HTTPTransport {
 	// Set defaults
 	if options.Timeout == 0 {
@@ -59,92 +99,222 @@ func NewHTTPTransport(options TransportOptions) *HTTPTransport {
 	if options.FlushPeriod == 0 {
 		options.FlushPeriod = 5 * time.Second
 	}
+	if options.CompressionThreshold == 0 {
+		options.CompressionThreshold = DefaultCompressionThreshold
+	}
 
 	t := &HTTPTransport{
-		options:  options,
-		dsn:      options.DSN,
-		endpoint: parseDSN(options.DSN),
+		options: options,
 		client: &http.Client{
 			Timeout: options.Timeout,
 		},
-		queue: make(chan *Event, 100),
-		done:  make(chan struct{}),
+		queue:     make(chan *Event, 100),
+		envelopes: make(chan *Envelope, 100),
+		flushes:   make(chan chan bool),
+		done:      make(chan struct{}),
+		limits:    newRateLimits(),
+	}
+
+	if dsn, err := ParseDSN(options.DSN); err != nil {
+		if options.Debug {
+			log.Printf("[statly] %v, events will be dropped", err)
+		}
+	} else {
+		t.dsn = dsn
+		t.endpoint = dsn.IngestURL()
+		t.envelopeEndpoint = dsn.EnvelopeURL()
+	}
+
+	if options.SpoolDir != "" {
+		spool, err := newSpool(options.SpoolDir, options.SpoolMaxSize, options.SpoolMaxAge)
+		if err != nil {
+			if options.Debug {
+				log.Printf("[statly] Failed to open spool, events will not be spooled: %v", err)
+			}
+		} else {
+			t.spool = spool
+			t.overflow = make(chan interface{}, 100)
+			t.spooled = make(chan struct{})
+		}
 	}
 
 	// Start background worker
 	t.wg.Add(1)
 	go t.worker()
 
+	// Spool events that do not fit the queue off the callers' goroutines
+	if t.spool != nil {
+		t.wg.Add(1)
+		go t.spooler()
+	}
+
 	return t
 }
 
-// parseDSN parses the DSN and returns the API endpoint.
-// DSN format: https://<api-key>@statly.live/<org-slug>
-func parseDSN(dsn string) string {
-	// Extract the host from the DSN URL
-	dsn = strings.TrimPrefix(dsn, "https://")
-	dsn = strings.TrimPrefix(dsn, "http://")
-
-	// Find the @ to get past the API key
-	if idx := strings.Index(dsn, "@"); idx != -1 {
-		dsn = dsn[idx+1:]
-	}
+// Send queues an event for sending.
+func (t *HTTPTransport) Send(event *Event) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 
-	// Extract just the host (before the path)
-	if idx := strings.Index(dsn, "/"); idx != -1 {
-		dsn = dsn[:idx]
+	if t.closed {
+		if t.options.Debug {
+			log.Printf("[statly] Transport closed, event dropped: %s", event.EventID)
+		}
+		return false
 	}
 
-	if dsn == "" {
-		dsn = "statly.live"
+	// Without a spool, events of rate limited categories are dropped. With
+	// one, they are queued and held on disk until the limit expires.
+	if t.spool == nil && t.limits.isLimited(eventCategory(event)) {
+		if t.options.Debug {
+			log.Printf("[statly] Rate limited, event dropped: %s", event.EventID)
+		}
+		return false
 	}
 
-	return fmt.Sprintf("https://%s/api/v1/observe/ingest", dsn)
-}
-
-// Send queues an event for sending.
-func (t *HTTPTransport) Send(event *Event) bool {
 	select {
 	case t.queue <- event:
 		if t.options.Debug {
 			log.Printf("[statly] Event queued: %s", event.EventID)
 		}
 		return true
-	case <-t.done:
-		return false
 	default:
+	}
+
+	// Hand events that do not fit the queue to the spooler
+	if t.spool != nil {
+		select {
+		case t.overflow <- event:
+			return true
+		default:
+		}
+	}
+
+	if t.options.Debug {
+		log.Printf("[statly] Queue full, event dropped: %s", event.EventID)
+	}
+	return false
+}
+
+// SendEnvelope queues an envelope for sending with the next batch. Items of
+// rate limited categories are dropped, or held in the spool if there is one.
+func (t *HTTPTransport) SendEnvelope(envelope *Envelope) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
 		if t.options.Debug {
-			log.Printf("[statly] Queue full, event dropped: %s", event.EventID)
+			log.Printf("[statly] Transport closed, envelope dropped")
 		}
 		return false
 	}
-}
 
-// Flush flushes pending events.
-func (t *HTTPTransport) Flush(timeout time.Duration) {
-	// Wait for queue to drain
-	deadline := time.Now().Add(timeout)
-	for {
-		select {
-		case <-time.After(100 * time.Millisecond):
-			if len(t.queue) == 0 || time.Now().After(deadline) {
-				return
+	if t.spool == nil {
+		envelope = envelope.withoutLimited(t.limits)
+		if envelope == nil {
+			if t.options.Debug {
+				log.Printf("[statly] Rate limited, envelope dropped")
 			}
+			return false
+		}
+	}
+
+	select {
+	case t.envelopes <- envelope:
+		return true
+	default:
+	}
+
+	// Hand envelopes that do not fit the queue to the spooler
+	if t.spool != nil {
+		select {
+		case t.overflow <- envelope:
+			return true
+		default:
 		}
 	}
+
+	if t.options.Debug {
+		log.Printf("[statly] Queue full, envelope dropped")
+	}
+	return false
 }
 
-// Close closes the transport.
+// IsRateLimited reports whether events of the category are dropped because
+// Statly rate limits them. Transports with a spool hold such events instead
+// of dropping them.
+func (t *HTTPTransport) IsRateLimited(category Category) bool {
+	return t.spool == nil && t.limits.isLimited(category)
+}
+
+// Flush sends pending events and reports whether they were all delivered
+// before the timeout.
+func (t *HTTPTransport) Flush(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// Ask the worker to send everything it holds
+	result := make(chan bool, 1)
+	select {
+	case t.flushes <- result:
+	case <-t.done:
+		return false
+	case <-timer.C:
+		return false
+	}
+
+	select {
+	case delivered := <-result:
+		return delivered
+	case <-timer.C:
+		if t.options.Debug {
+			log.Printf("[statly] Flush timed out after %s", timeout)
+		}
+		return false
+	}
+}
+
+// Close sends pending events and stops the transport, waiting at most
+// timeout for delivery. Requests are not retried past the timeout; with a
+// spool, pending events are written to it first and those not delivered in
+// time stay there. Calling Close more than once is a no-op.
 func (t *HTTPTransport) Close(timeout time.Duration) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	t.deadline.Store(time.Now().Add(timeout).UnixNano())
 	close(t.done)
-	t.wg.Wait()
+	t.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		if t.options.Debug {
+			log.Printf("[statly] Close timed out after %s, pending events may be lost", timeout)
+		}
+	}
 }
 
 // worker processes events in the background.
 func (t *HTTPTransport) worker() {
 	defer t.wg.Done()
 
+	// Send events spooled by previous processes
+	if t.spool != nil {
+		t.replaySpool()
+	}
+
 	var batch []*Event
+	var envelopes []*Envelope
 	timer := time.NewTimer(t.options.FlushPeriod)
 	defer timer.Stop()
 
@@ -160,67 +330,350 @@ func (t *HTTPTransport) worker() {
 				timer.Reset(t.options.FlushPeriod)
 			}
 
+		case envelope := <-t.envelopes:
+			envelopes = append(envelopes, envelope)
+
+			// Send if enough envelopes are pending
+			if len(envelopes) >= t.options.BatchSize {
+				t.sendEnvelopes(envelopes)
+				envelopes = nil
+			}
+
 		case <-timer.C:
-			// Send pending batch
-			if len(batch) > 0 {
+			// Send pending batch and envelopes
+			if len(batch) > 0 || len(envelopes) > 0 {
 				t.sendBatch(batch)
-				batch = nil
+				t.sendEnvelopes(envelopes)
+				batch, envelopes = nil, nil
+			} else if t.spool != nil {
+				t.replaySpool()
 			}
 			timer.Reset(t.options.FlushPeriod)
 
+		case result := <-t.flushes:
+			result <- t.drain(batch, envelopes)
+			batch, envelopes = nil, nil
+
 		case <-t.done:
-			// Send remaining events
-			if len(batch) > 0 {
-				t.sendBatch(batch)
+			if t.spool == nil {
+				t.drain(batch, envelopes)
+				return
+			}
+
+			// Keep everything pending on disk first, then send what can be
+			// delivered before the close deadline
+			t.spoolPending(batch, envelopes)
+			<-t.spooled
+			t.replaySpool()
+			t.spool.close()
+			return
+		}
+	}
+}
+
+// spoolPending writes the given events and envelopes and every queued event
+// and envelope to the spool without sending them.
+func (t *HTTPTransport) spoolPending(batch []*Event, envelopes []*Envelope) {
+	var records []json.RawMessage
+	add := func(data []byte, err error) {
+		if err != nil {
+			if t.options.Debug {
+				log.Printf("[statly] Failed to spool: %v", err)
 			}
+			return
+		}
+		records = append(records, data)
+	}
+
+	for _, event := range batch {
+		add(safeMarshal(event))
+	}
+	for _, envelope := range envelopes {
+		add(envelopeRecord(envelope))
+	}
+	for pending := true; pending; {
+		select {
+		case event := <-t.queue:
+			add(safeMarshal(event))
+		case envelope := <-t.envelopes:
+			add(envelopeRecord(envelope))
+		default:
+			pending = false
+		}
+	}
+
+	if len(records) > 0 {
+		t.spoolRecords(records)
+	}
+}
 
-			// Drain queue
-			for {
-				select {
-				case event := <-t.queue:
-					batch = append(batch, event)
-					if len(batch) >= t.options.BatchSize {
-						t.sendBatch(batch)
-						batch = nil
-					}
-				default:
-					if len(batch) > 0 {
-						t.sendBatch(batch)
-					}
-					return
+// spooler writes events and envelopes that did not fit the queue to the
+// spool. Those that arrive together are written at once. On close it writes
+// the remaining ones before the worker closes the spool.
+func (t *HTTPTransport) spooler() {
+	defer t.wg.Done()
+	defer close(t.spooled)
+
+	for {
+		select {
+		case item := <-t.overflow:
+			t.spoolOverflow(item)
+		case <-t.done:
+			select {
+			case item := <-t.overflow:
+				t.spoolOverflow(item)
+			default:
+				return
+			}
+		}
+	}
+}
+
+// spoolOverflow writes an event or envelope and the others waiting in the
+// overflow queue to the spool.
+func (t *HTTPTransport) spoolOverflow(item interface{}) {
+	var records []json.RawMessage
+	for item != nil {
+		var data []byte
+		var err error
+		switch item := item.(type) {
+		case *Event:
+			data, err = safeMarshal(item)
+		case *Envelope:
+			data, err = envelopeRecord(item)
+		}
+		if err == nil {
+			records = append(records, data)
+		} else if t.options.Debug {
+			log.Printf("[statly] Failed to spool: %v", err)
+		}
+
+		select {
+		case item = <-t.overflow:
+		default:
+			item = nil
+		}
+	}
+
+	if len(records) > 0 {
+		t.spoolRecords(records)
+	}
+}
+
+// drain sends the given events and envelopes and every queued event and
+// envelope. It reports whether all of them were delivered.
+func (t *HTTPTransport) drain(batch []*Event, envelopes []*Envelope) bool {
+	delivered := true
+
+	for {
+		select {
+		case event := <-t.queue:
+			batch = append(batch, event)
+			if len(batch) >= t.options.BatchSize {
+				if !t.sendBatch(batch) {
+					delivered = false
+				}
+				batch = nil
+			}
+		case envelope := <-t.envelopes:
+			envelopes = append(envelopes, envelope)
+			if len(envelopes) >= t.options.BatchSize {
+				if !t.sendEnvelopes(envelopes) {
+					delivered = false
 				}
+				envelopes = nil
+			}
+		default:
+			if len(batch) > 0 && !t.sendBatch(batch) {
+				delivered = false
+			}
+			if len(envelopes) > 0 && !t.sendEnvelopes(envelopes) {
+				delivered = false
 			}
+			if t.spool != nil && (!t.replaySpool() || !t.spool.empty() || len(t.overflow) > 0) {
+				delivered = false
+			}
+			return delivered
 		}
 	}
 }
 
-// sendBatch sends a batch of events.
-func (t *HTTPTransport) sendBatch(batch []*Event) {
+// sendBatch sends a batch of events and reports whether it was delivered.
+// Events of rate limited categories are dropped. With a spool, they are
+// written to disk instead, as are events that could not be delivered because
+// Statly was unreachable or rate limiting, and spooled events are sent first
+// so events arrive in order.
+func (t *HTTPTransport) sendBatch(batch []*Event) bool {
 	if len(batch) == 0 {
-		return
+		return true
+	}
+
+	// Marshal events individually so one bad event does not lose the batch
+	records := make([]json.RawMessage, 0, len(batch))
+	var held []json.RawMessage
+	for _, event := range batch {
+		limited := t.limits.isLimited(eventCategory(event))
+		if limited && t.spool == nil {
+			if t.options.Debug {
+				log.Printf("[statly] Rate limited, event dropped: %s", event.EventID)
+			}
+			continue
+		}
+
+		data, err := safeMarshal(event)
+		if err != nil {
+			if t.options.Debug {
+				log.Printf("[statly] Failed to marshal event %s: %v", event.EventID, err)
+			}
+			continue
+		}
+		if limited {
+			held = append(held, data)
+		} else {
+			records = append(records, data)
+		}
+	}
+
+	if len(held) > 0 {
+		t.spoolRecords(held)
+	}
+
+	complete := len(records) == len(batch)
+	if len(records) == 0 {
+		return false
+	}
+
+	if t.spool != nil && !t.replaySpool() {
+		t.spoolRecords(records)
+		return false
+	}
+
+	result := t.send(records)
+	if (result == sendUnreachable || result == sendRateLimited) && t.spool != nil {
+		t.spoolRecords(records)
+	}
+
+	return result == sendDelivered && complete
+}
+
+// sendEnvelopes sends pending envelopes, merged into as few requests as
+// their events allow, and reports whether all of them were delivered.
+func (t *HTTPTransport) sendEnvelopes(envelopes []*Envelope) bool {
+	delivered := true
+	for _, envelope := range mergeEnvelopes(envelopes) {
+		if !t.sendEnvelope(envelope) {
+			delivered = false
+		}
+	}
+	return delivered
+}
+
+// sendEnvelope sends an envelope and reports whether it was delivered. Items
+// of rate limited categories are dropped. With a spool, they are written to
+// disk instead, as is the envelope if it could not be delivered because
+// Statly was unreachable or rate limiting, and spooled events and envelopes
+// are sent first so they arrive in order.
+func (t *HTTPTransport) sendEnvelope(envelope *Envelope) bool {
+	allowed, limited := envelope.splitLimited(t.limits)
+	if t.spool == nil {
+		return allowed != nil && t.postEnvelope(allowed) == sendDelivered
+	}
+
+	if limited != nil {
+		t.spoolEnvelope(limited)
+	}
+	if allowed == nil {
+		return false
+	}
+
+	if !t.replaySpool() {
+		t.spoolEnvelope(allowed)
+		return false
+	}
+
+	result := t.postEnvelope(allowed)
+	if result == sendUnreachable || result == sendRateLimited {
+		t.spoolEnvelope(allowed)
+	}
+
+	return result == sendDelivered && limited == nil
+}
+
+// postEnvelope sends an envelope and reports the result of the request.
+func (t *HTTPTransport) postEnvelope(envelope *Envelope) int {
+	data, err := envelope.MarshalBinary()
+	if err != nil {
+		if t.options.Debug {
+			log.Printf("[statly] Failed to encode envelope: %v", err)
+		}
+		return sendRejected
 	}
 
-	// Build request body
+	return t.post(t.envelopeEndpoint, EnvelopeContentType, data, len(envelope.Items))
+}
+
+// Results of sending events.
+const (
+	sendDelivered = iota
+	sendRejected
+	sendUnreachable
+	sendRateLimited
+)
+
+// send posts serialized events and reports the result of the request.
+func (t *HTTPTransport) send(records []json.RawMessage) int {
 	type requestBody struct {
-		Events []*Event `json:"events"`
+		Events []json.RawMessage `json:"events"`
 	}
 
-	body := requestBody{Events: batch}
-	data, err := json.Marshal(body)
+	data, err := json.Marshal(requestBody{Events: records})
 	if err != nil {
 		if t.options.Debug {
 			log.Printf("[statly] Failed to marshal events: %v", err)
 		}
-		return
+		return sendRejected
+	}
+
+	return t.post(t.endpoint, "application/json", data, len(records))
+}
+
+// post sends a request body holding count items, retrying on network and
+// server errors. It reports whether the items were delivered, rejected by
+// Statly, rate limited, or could not be delivered after all retries. Rate
+// limits sent by Statly are recorded from every response.
+func (t *HTTPTransport) post(endpoint, contentType string, data []byte, count int) int {
+	if t.dsn == nil {
+		if t.options.Debug {
+			log.Printf("[statly] Invalid DSN, %d events dropped", count)
+		}
+		return sendRejected
+	}
+
+	data, encoding := compressBody(data, t.options)
+
+	// Once the transport is closing, requests end at the close deadline
+	ctx := context.Background()
+	deadline := t.closeDeadline()
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
 	}
 
 	// Retry loop
 	for attempt := 0; attempt < t.options.MaxRetries; attempt++ {
 		if attempt > 0 {
-			time.Sleep(t.options.RetryDelay * time.Duration(1<<attempt))
+			delay := t.options.RetryDelay * time.Duration(1<<attempt)
+			if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+				if t.options.Debug {
+					log.Printf("[statly] Transport closing, %d events not retried", count)
+				}
+				break
+			}
+			time.Sleep(delay)
 		}
 
-		req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(data))
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(data))
 		if err != nil {
 			if t.options.Debug {
 				log.Printf("[statly] Failed to create request: %v", err)
@@ -228,9 +681,12 @@ func (t *HTTPTransport) sendBatch(batch []*Event) {
 			continue
 		}
 
-		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Type", contentType)
 		req.Header.Set("User-Agent", fmt.Sprintf("statly-observe-go/%s", Version))
-		req.Header.Set("X-Statly-DSN", t.dsn)
+		t.dsn.setAuthHeaders(req)
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
 
 		resp, err := t.client.Do(req)
 		if err != nil {
@@ -240,12 +696,21 @@ func (t *HTTPTransport) sendBatch(batch []*Event) {
 			continue
 		}
 		resp.Body.Close()
+		t.limits.update(resp)
 
 		if resp.StatusCode == 200 || resp.StatusCode == 202 {
 			if t.options.Debug {
-				log.Printf("[statly] Sent %d events successfully", len(batch))
+				log.Printf("[statly] Sent %d events successfully", count)
 			}
-			return
+			return sendDelivered
+		}
+
+		// Back off until the rate limit expires instead of retrying
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if t.options.Debug {
+				log.Printf("[statly] Rate limited, %d events not sent", count)
+			}
+			return sendRateLimited
 		}
 
 		// Don't retry on 4xx errors
@@ -253,7 +718,7 @@ func (t *HTTPTransport) sendBatch(batch []*Event) {
 			if t.options.Debug {
 				log.Printf("[statly] Client error %d, not retrying", resp.StatusCode)
 			}
-			return
+			return sendRejected
 		}
 
 		if t.options.Debug {
@@ -262,19 +727,32 @@ func (t *HTTPTransport) sendBatch(batch []*Event) {
 	}
 
 	if t.options.Debug {
-		log.Printf("[statly] Failed to send %d events after %d retries", len(batch), t.options.MaxRetries)
+		log.Printf("[statly] Failed to send %d events after %d retries", count, t.options.MaxRetries)
+	}
+	return sendUnreachable
+}
+
+// closeDeadline returns when Close stops waiting, or the zero time while the
+// transport is open.
+func (t *HTTPTransport) closeDeadline() time.Time {
+	if deadline := t.deadline.Load(); deadline != 0 {
+		return time.Unix(0, deadline)
 	}
+	return time.Time{}
 }
 
 // SyncTransport sends events synchronously (useful for testing).
 type SyncTransport struct {
-	options  TransportOptions
-	dsn      string
-	endpoint string
-	client   *http.Client
+	options          TransportOptions
+	dsn              *DSN
+	endpoint         string
+	envelopeEndpoint string
+	client           *http.Client
+	limits           *rateLimits
 }
 
-// NewSyncTransport creates a new synchronous transport.
+// NewSyncTransport creates a new synchronous transport. Events are dropped
+// when the DSN is invalid; NewClient reports invalid DSNs.
 func NewSyncTransport(options TransportOptions) *SyncTransport {
 	if options.Timeout == 0 {
 		options.Timeout = 30 * time.Second
@@ -282,43 +760,90 @@ func NewSyncTransport(options TransportOptions) *SyncTransport {
 	if options.MaxRetries == 0 {
 		options.MaxRetries = 3
 	}
+	if options.CompressionThreshold == 0 {
+		options.CompressionThreshold = DefaultCompressionThreshold
+	}
 
-	return &SyncTransport{
-		options:  options,
-		dsn:      options.DSN,
-		endpoint: parseDSN(options.DSN),
+	t := &SyncTransport{
+		options: options,
 		client: &http.Client{
 			Timeout: options.Timeout,
 		},
+		limits: newRateLimits(),
+	}
+
+	if dsn, err := ParseDSN(options.DSN); err == nil {
+		t.dsn = dsn
+		t.endpoint = dsn.IngestURL()
+		t.envelopeEndpoint = dsn.EnvelopeURL()
 	}
+
+	return t
 }
 
-// Send sends an event synchronously.
+// Send sends an event synchronously. Events of rate limited categories are
+// dropped.
 func (t *SyncTransport) Send(event *Event) bool {
-	data, err := json.Marshal(event)
+	if t.limits.isLimited(eventCategory(event)) {
+		return false
+	}
+
+	data, err := safeMarshal(event)
+	if err != nil {
+		return false
+	}
+
+	return t.post(t.endpoint, "application/json", data)
+}
+
+// SendEnvelope sends an envelope synchronously. Items of rate limited
+// categories are dropped.
+func (t *SyncTransport) SendEnvelope(envelope *Envelope) bool {
+	envelope = envelope.withoutLimited(t.limits)
+	if envelope == nil {
+		return false
+	}
+
+	data, err := envelope.MarshalBinary()
 	if err != nil {
 		return false
 	}
 
+	return t.post(t.envelopeEndpoint, EnvelopeContentType, data)
+}
+
+// post sends a request body, retrying on network and server errors, and
+// reports whether it was delivered.
+func (t *SyncTransport) post(endpoint, contentType string, data []byte) bool {
+	if t.dsn == nil {
+		return false
+	}
+
+	data, encoding := compressBody(data, t.options)
+
 	for attempt := 0; attempt < t.options.MaxRetries; attempt++ {
 		if attempt > 0 {
 			time.Sleep(t.options.RetryDelay * time.Duration(1<<attempt))
 		}
 
-		req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(data))
+		req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
 		if err != nil {
 			continue
 		}
 
-		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Type", contentType)
 		req.Header.Set("User-Agent", fmt.Sprintf("statly-observe-go/%s", Version))
-		req.Header.Set("X-Statly-DSN", t.dsn)
+		t.dsn.setAuthHeaders(req)
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
 
 		resp, err := t.client.Do(req)
 		if err != nil {
 			continue
 		}
 		resp.Body.Close()
+		t.limits.update(resp)
 
 		if resp.StatusCode == 200 || resp.StatusCode == 202 {
 			return true
@@ -332,8 +857,16 @@ func (t *SyncTransport) Send(event *Event) bool {
 	return false
 }
 
-// Flush is a no-op for sync transport.
-func (t *SyncTransport) Flush(timeout time.Duration) {}
+// IsRateLimited reports whether events of the category are dropped because
+// Statly rate limits them.
+func (t *SyncTransport) IsRateLimited(category Category) bool {
+	return t.limits.isLimited(category)
+}
+
+// Flush is a no-op for sync transport. Events are delivered by Send.
+func (t *SyncTransport) Flush(timeout time.Duration) bool {
+	return true
+}
 
 // Close is a no-op for sync transport.
 func (t *SyncTransport) Close(timeout time.Duration) {}
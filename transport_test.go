@@ -0,0 +1,949 @@
+package statly
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestHTTPTransport creates an HTTP transport that posts to server.
+func newTestHTTPTransport(server *httptest.Server, options TransportOptions) *HTTPTransport {
+	options.DSN = "http://sk_test_xxx@" + server.Listener.Addr().String() + "/test"
+	return NewHTTPTransport(options)
+}
+
+func TestHTTPTransportFlush(t *testing.T) {
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{FlushPeriod: time.Hour})
+	defer transport.Close(time.Second)
+
+	transport.Send(NewMessageEvent("test", LevelInfo))
+
+	if !transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to report delivery")
+	}
+
+	if atomic.LoadInt32(&received) != 1 {
+		t.Errorf("Expected 1 request, got %d", received)
+	}
+}
+
+func TestHTTPTransportAuthHeaders(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{FlushPeriod: time.Hour})
+	defer transport.Close(time.Second)
+
+	transport.Send(NewMessageEvent("hello", LevelInfo))
+	if !transport.Flush(time.Second) {
+		t.Fatalf("Expected event to be delivered")
+	}
+
+	if got := header.Get("Authorization"); got != "Bearer sk_test_xxx" {
+		t.Errorf("Expected key in Authorization header, got %q", got)
+	}
+	if got := header.Get("X-Statly-Org"); got != "test" {
+		t.Errorf("Expected org header, got %q", got)
+	}
+	if header.Get("X-Statly-DSN") != "" {
+		t.Errorf("Expected DSN not to be sent")
+	}
+}
+
+func TestHTTPTransportFlushFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{FlushPeriod: time.Hour})
+	defer transport.Close(time.Second)
+
+	transport.Send(NewMessageEvent("test", LevelInfo))
+
+	if transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to report failed delivery")
+	}
+}
+
+func TestHTTPTransportCloseTwice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{})
+
+	transport.Close(time.Second)
+	transport.Close(time.Second)
+
+	if transport.Send(NewMessageEvent("test", LevelInfo)) {
+		t.Errorf("Expected Send to fail after Close")
+	}
+
+	if transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to fail after Close")
+	}
+}
+
+func TestHTTPTransportCloseTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	transport := newTestHTTPTransport(server, TransportOptions{})
+	transport.Send(NewMessageEvent("test", LevelInfo))
+
+	start := time.Now()
+	transport.Close(100 * time.Millisecond)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Close to honor its timeout, took %s", elapsed)
+	}
+}
+
+func TestClientLifecycle(t *testing.T) {
+	transport := NewMockTransport()
+
+	err := Init(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+
+	client := GetClient()
+	if !client.IsEnabled() || !IsEnabled() {
+		t.Errorf("Expected client to be enabled")
+	}
+
+	Close()
+	Close()
+	client.Close()
+
+	if client.IsEnabled() || IsEnabled() {
+		t.Errorf("Expected client to be disabled after Close")
+	}
+
+	if client.CaptureMessage("test", LevelInfo) != "" {
+		t.Errorf("Expected capture after Close to be dropped")
+	}
+
+	if len(transport.Events()) != 0 {
+		t.Errorf("Expected no events after Close")
+	}
+
+	// Reinitialize after Close
+	transport = NewMockTransport()
+	err = Init(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("Failed to reinitialize: %v", err)
+	}
+	defer Close()
+
+	CaptureMessage("test", LevelInfo)
+	if len(transport.Events()) != 1 {
+		t.Errorf("Expected event after reinitialization")
+	}
+}
+
+func TestHTTPTransportUnserializableEvent(t *testing.T) {
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Events []*Event `json:"events"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		atomic.AddInt32(&received, int32(len(body.Events)))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{FlushPeriod: time.Hour})
+	defer transport.Close(time.Second)
+
+	bad := NewMessageEvent("bad", LevelInfo)
+	bad.Extra["channel"] = make(chan int)
+
+	transport.Send(bad)
+	transport.Send(NewMessageEvent("good", LevelInfo))
+
+	if transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to report the event that could not be sent")
+	}
+	if atomic.LoadInt32(&received) != 1 {
+		t.Errorf("Expected the serializable event to be sent, got %d events", received)
+	}
+}
+
+func TestHTTPTransportSpool(t *testing.T) {
+	var up atomic.Bool
+	var mu sync.Mutex
+	var received []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body struct {
+			Events []*Event `json:"events"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		for _, event := range body.Events {
+			received = append(received, event.Message)
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	options := TransportOptions{
+		FlushPeriod: time.Hour,
+		MaxRetries:  1,
+		SpoolDir:    t.TempDir(),
+	}
+
+	// Statly is unreachable: events are spooled
+	transport := newTestHTTPTransport(server, options)
+	transport.Send(NewMessageEvent("first", LevelInfo))
+	transport.Send(NewMessageEvent("second", LevelInfo))
+	if transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to fail while Statly is unreachable")
+	}
+	transport.Close(time.Second)
+
+	segments, _ := filepath.Glob(filepath.Join(options.SpoolDir, "*.spool"))
+	if len(segments) == 0 {
+		t.Fatalf("Expected events to be spooled")
+	}
+
+	// A new transport replays the spool in order once Statly is reachable
+	up.Store(true)
+	transport = newTestHTTPTransport(server, options)
+	defer transport.Close(time.Second)
+
+	transport.Send(NewMessageEvent("third", LevelInfo))
+	if !transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to deliver spooled events")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(received, ",") != "first,second,third" {
+		t.Errorf("Expected events in order, got %v", received)
+	}
+
+	segments, _ = filepath.Glob(filepath.Join(options.SpoolDir, "*.spool"))
+	if len(segments) != 0 {
+		t.Errorf("Expected spool to be empty, got %d segments", len(segments))
+	}
+}
+
+func TestHTTPTransportCloseSpools(t *testing.T) {
+	// Nothing listens on the address: connections are refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	dir := t.TempDir()
+	transport := NewHTTPTransport(TransportOptions{
+		DSN:         "http://sk_test_xxx@" + addr + "/test",
+		FlushPeriod: time.Hour,
+		SpoolDir:    dir,
+	})
+	for i := 0; i < 3; i++ {
+		transport.Send(NewMessageEvent(fmt.Sprintf("event %d", i), LevelInfo))
+	}
+
+	// Retries that would end after the close deadline are not attempted
+	start := time.Now()
+	transport.Close(time.Second)
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected Close to return before its deadline, took %v", elapsed)
+	}
+
+	s, err := newSpool(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	defer s.close()
+
+	var records int
+	for _, seq := range s.sequences() {
+		segment, _ := s.read(seq)
+		records += len(segment)
+	}
+	if records != 3 {
+		t.Errorf("Expected 3 spooled events, got %d", records)
+	}
+}
+
+func TestHTTPTransportQueueOverflow(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{
+		BatchSize:   1,
+		FlushPeriod: time.Hour,
+		SpoolDir:    t.TempDir(),
+	})
+	defer transport.Close(time.Second)
+	defer close(release)
+
+	// The worker is blocked sending the first event: events that do not fit
+	// the queue are spooled by the spooler
+	for i := 0; i < 150; i++ {
+		if !transport.Send(NewMessageEvent(fmt.Sprintf("event %d", i), LevelInfo)) {
+			t.Fatalf("Expected event %d to be queued or spooled", i)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, records, _ := transport.spool.oldest()
+		if len(records) >= 49 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected overflowing events to be spooled, got %d", len(records))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHTTPTransportSpoolRateLimitedCategory(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Events []*Event `json:"events"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		for _, event := range body.Events {
+			received = append(received, event.Message)
+		}
+		mu.Unlock()
+		w.Header().Set(RateLimitsHeader, "60:error")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{
+		FlushPeriod: time.Hour,
+		SpoolDir:    t.TempDir(),
+	})
+	defer transport.Close(time.Second)
+
+	transport.Send(NewMessageEvent("probe", LevelInfo))
+	if !transport.Flush(time.Second) {
+		t.Fatalf("Expected first event to be delivered")
+	}
+
+	// Errors are limited: spooled errors are held while messages are sent
+	transport.spool.append([]json.RawMessage{
+		json.RawMessage(`{"message":"held","exception":[{"type":"E","value":"v"}]}`),
+		json.RawMessage(`{"message":"spooled"}`),
+	})
+	transport.Send(NewMessageEvent("sent", LevelInfo))
+	if transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to report the held event")
+	}
+
+	mu.Lock()
+	if strings.Join(received, ",") != "probe,spooled,sent" {
+		t.Errorf("Expected messages to be sent while errors are limited, got %v", received)
+	}
+	mu.Unlock()
+
+	_, records, ok := transport.spool.oldest()
+	if !ok || len(records) != 1 || !strings.Contains(string(records[0]), "held") {
+		t.Errorf("Expected the limited error to stay spooled, got %q", records)
+	}
+}
+
+func TestSpoolRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	torn := "{\"message\":\"kept\"}\n{\"message\":\"to"
+	os.WriteFile(filepath.Join(dir, "00000000000000000007.spool"), []byte(torn), 0o600)
+	os.WriteFile(filepath.Join(dir, "00000000000000000008.spool.tmp"), []byte("{}\n"), 0o600)
+
+	s, err := newSpool(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	defer s.close()
+
+	seq, records, ok := s.oldest()
+	if !ok || seq != 7 || len(records) != 1 || string(records[0]) != `{"message":"kept"}` {
+		t.Errorf("Expected the complete record of segment 7, got %d %q", seq, records)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "00000000000000000008.spool.tmp")); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary file to be removed")
+	}
+
+	// New events go to a new segment
+	s.append([]json.RawMessage{json.RawMessage(`{"message":"new"}`)})
+	if _, err := os.Stat(filepath.Join(dir, "00000000000000000008.spool")); err != nil {
+		t.Errorf("Expected new segment after the recovered ones: %v", err)
+	}
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := newSpool(dir, 150, 0)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	defer s.close()
+	s.segmentSize = 40
+
+	record := json.RawMessage(`{"message":"0123456789012345678"}`)
+	for i := 0; i < 10; i++ {
+		s.append([]json.RawMessage{record})
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.spool"))
+	if len(segments) != 2 {
+		t.Errorf("Expected the newest segments within the size cap, got %d", len(segments))
+	}
+	if seq, _, _ := s.oldest(); seq != 3 {
+		t.Errorf("Expected oldest segments to be dropped, oldest is %d", seq)
+	}
+}
+
+func TestHTTPTransportRateLimit(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{FlushPeriod: time.Hour, MaxRetries: 3})
+	defer transport.Close(time.Second)
+
+	transport.Send(NewMessageEvent("limited", LevelInfo))
+	if transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to fail when rate limited")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected 429 not to be retried, got %d requests", n)
+	}
+
+	for _, category := range []Category{CategoryError, CategoryMessage, CategoryTransaction, CategorySession} {
+		if !transport.IsRateLimited(category) {
+			t.Errorf("Expected %s to be rate limited", category)
+		}
+	}
+	if transport.Send(NewMessageEvent("dropped", LevelInfo)) {
+		t.Errorf("Expected Send to drop events while rate limited")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected no requests while rate limited, got %d", n)
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	now := time.Now()
+	limits := parseRateLimits("60:error;message:organization, 10:, bogus, 30:error", now)
+
+	if got := limits[CategoryError]; !got.Equal(now.Add(60 * time.Second)) {
+		t.Errorf("Expected error limit of 60s, got %s", got.Sub(now))
+	}
+	if got := limits[CategoryMessage]; !got.Equal(now.Add(60 * time.Second)) {
+		t.Errorf("Expected message limit of 60s, got %s", got.Sub(now))
+	}
+	if got := limits[categoryAll]; !got.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("Expected limit of all categories of 10s, got %s", got.Sub(now))
+	}
+	if len(limits) != 3 {
+		t.Errorf("Expected 3 limits, got %v", limits)
+	}
+
+	date := now.Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date, now); got < time.Minute || got > 2*time.Minute {
+		t.Errorf("Expected HTTP date Retry-After of about 2m, got %s", got)
+	}
+	if got := parseRetryAfter("", now); got != defaultRetryAfter {
+		t.Errorf("Expected default Retry-After, got %s", got)
+	}
+}
+
+func TestClientRateLimitedCategory(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	limited := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Events []*Event `json:"events"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, event := range body.Events {
+			received = append(received, event.Message)
+		}
+		if !limited {
+			limited = true
+			w.Header().Set(RateLimitsHeader, "60:message")
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{FlushPeriod: time.Hour})
+	built := 0
+	client, _ := NewClient(Options{
+		DSN:       "https://sk_test_xxx@statly.live/test",
+		Transport: transport,
+		BeforeSend: func(event *Event, hint *EventHint) *Event {
+			built++
+			return event
+		},
+	})
+	defer client.Close()
+
+	client.CaptureMessage("first", LevelInfo)
+	client.Flush()
+
+	if !transport.IsRateLimited(CategoryMessage) || transport.IsRateLimited(CategoryError) {
+		t.Fatalf("Expected only messages to be rate limited")
+	}
+
+	client.CaptureMessage("second", LevelInfo)
+	client.CaptureException(errors.New("boom"))
+	client.Flush()
+
+	if built != 2 {
+		t.Errorf("Expected the limited message not to be built, got %d events", built)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 || received[0] != "first" {
+		t.Errorf("Expected first message and the error, got %v", received)
+	}
+}
+
+func TestHTTPTransportCompression(t *testing.T) {
+	var mu sync.Mutex
+	var encodings, received []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+
+		var payload struct {
+			Events []*Event `json:"events"`
+		}
+		if err := json.NewDecoder(body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		for _, event := range payload.Events {
+			received = append(received, event.Message)
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{
+		FlushPeriod: time.Hour,
+		Compressor:  GzipCompressor{},
+	})
+	defer transport.Close(time.Second)
+
+	// Small bodies are sent as they are
+	transport.Send(NewMessageEvent("small", LevelInfo))
+	if !transport.Flush(time.Second) {
+		t.Fatalf("Expected small event to be delivered")
+	}
+
+	transport.Send(NewMessageEvent(strings.Repeat("large ", 1000), LevelInfo))
+	if !transport.Flush(time.Second) {
+		t.Fatalf("Expected large event to be delivered")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(encodings) != 2 || encodings[0] != "" || encodings[1] != "gzip" {
+		t.Errorf("Expected only the large body to be compressed, got encodings %q", encodings)
+	}
+	if len(received) != 2 || received[0] != "small" {
+		t.Errorf("Expected both events to be received, got %d", len(received))
+	}
+}
+
+func TestGzipCompressorLevels(t *testing.T) {
+	data := []byte(strings.Repeat("large ", 1000))
+
+	compressors := []GzipCompressor{
+		{},
+		{Level: gzip.BestSpeed},
+		{Level: gzip.HuffmanOnly},
+		{NoCompression: true},
+	}
+	for _, compressor := range compressors {
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			t.Fatalf("%+v: failed to compress: %v", compressor, err)
+		}
+
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("%+v: invalid gzip stream: %v", compressor, err)
+		}
+		decompressed, _ := io.ReadAll(zr)
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%+v: expected the original data back", compressor)
+		}
+
+		stored := len(compressed) > len(data)
+		if stored != compressor.NoCompression {
+			t.Errorf("%+v: got %d bytes from %d", compressor, len(compressed), len(data))
+		}
+	}
+}
+
+func TestEnvelopeEncoding(t *testing.T) {
+	event := NewMessageEvent("hello", LevelInfo)
+
+	envelope := NewEnvelope()
+	if err := envelope.AddEvent(event); err != nil {
+		t.Fatalf("AddEvent failed: %v", err)
+	}
+	envelope.AddJSON(ItemSession, map[string]interface{}{"status": "ok"})
+	envelope.AddAttachment("log.txt", "text/plain", []byte("line 1\nline 2\n"))
+
+	data, err := envelope.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	decoded, err := DecodeEnvelope(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeEnvelope failed: %v", err)
+	}
+	if decoded.Header.EventID != event.EventID {
+		t.Errorf("Expected envelope event ID %s, got %s", event.EventID, decoded.Header.EventID)
+	}
+	if len(decoded.Items) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(decoded.Items))
+	}
+
+	var decodedEvent Event
+	if err := json.Unmarshal(decoded.Items[0].Payload, &decodedEvent); err != nil || decodedEvent.Message != "hello" {
+		t.Errorf("Expected event item to round trip, got %s", decoded.Items[0].Payload)
+	}
+	if decoded.Items[1].Header.Type != ItemSession {
+		t.Errorf("Expected session item, got %s", decoded.Items[1].Header.Type)
+	}
+	attachment := decoded.Items[2]
+	if attachment.Header.Filename != "log.txt" || string(attachment.Payload) != "line 1\nline 2\n" {
+		t.Errorf("Expected attachment to round trip, got %q", attachment.Payload)
+	}
+
+	// Items without a length take the rest of their line
+	decoded, err = DecodeEnvelope(strings.NewReader("{}\n{\"type\":\"check_in\"}\n{\"status\":\"ok\"}\n"))
+	if err != nil {
+		t.Fatalf("DecodeEnvelope failed: %v", err)
+	}
+	if len(decoded.Items) != 1 || string(decoded.Items[0].Payload) != `{"status":"ok"}` {
+		t.Errorf("Expected check-in item, got %+v", decoded.Items)
+	}
+
+	if _, err := DecodeEnvelope(strings.NewReader("{}\n{\"type\":\"event\",\"length\":100}\n{}")); err == nil {
+		t.Errorf("Expected truncated item to fail")
+	}
+}
+
+func TestDecodeEnvelopeInvalidLength(t *testing.T) {
+	header := `{"sdk":{"name":"statly-observe-go","version":"1.0.0"}}` + "\n"
+
+	for _, length := range []string{"-1", "5", "1099511627776"} {
+		data := header + `{"type":"attachment","length":` + length + "}\nabc\n"
+		if _, err := DecodeEnvelope(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected an error for item length %s", length)
+		}
+	}
+}
+
+func TestHTTPTransportSpoolEnvelope(t *testing.T) {
+	var up atomic.Bool
+	var mu sync.Mutex
+	var received []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var events []*Event
+		if r.Header.Get("Content-Type") == EnvelopeContentType {
+			envelope, err := DecodeEnvelope(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, item := range envelope.Items {
+				var event Event
+				json.Unmarshal(item.Payload, &event)
+				events = append(events, &event)
+			}
+		} else {
+			var body struct {
+				Events []*Event `json:"events"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			events = body.Events
+		}
+
+		mu.Lock()
+		for _, event := range events {
+			received = append(received, event.Message)
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	options := TransportOptions{
+		FlushPeriod: time.Hour,
+		MaxRetries:  1,
+		SpoolDir:    t.TempDir(),
+	}
+
+	// Statly is unreachable: events and envelopes are spooled
+	transport := newTestHTTPTransport(server, options)
+	transport.Send(NewMessageEvent("first", LevelInfo))
+	transport.Flush(time.Second)
+	envelope := NewEnvelope()
+	envelope.AddEvent(NewMessageEvent("enveloped", LevelInfo))
+	transport.SendEnvelope(envelope)
+	if transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to fail while Statly is unreachable")
+	}
+	transport.Close(time.Second)
+
+	// A new transport replays both in order once Statly is reachable
+	up.Store(true)
+	transport = newTestHTTPTransport(server, options)
+	defer transport.Close(time.Second)
+
+	transport.Send(NewMessageEvent("last", LevelInfo))
+	if !transport.Flush(time.Second) {
+		t.Errorf("Expected Flush to deliver spooled events and envelopes")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(received, ",") != "first,enveloped,last" {
+		t.Errorf("Expected events and envelopes in order, got %v", received)
+	}
+}
+
+func TestHTTPTransportSendEnvelope(t *testing.T) {
+	var mu sync.Mutex
+	var items []ItemType
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/observe/envelope" || r.Header.Get("Content-Type") != EnvelopeContentType {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		envelope, err := DecodeEnvelope(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		for _, item := range envelope.Items {
+			items = append(items, item.Header.Type)
+		}
+		mu.Unlock()
+
+		w.Header().Set(RateLimitsHeader, "60:session")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{FlushPeriod: time.Hour})
+	defer transport.Close(time.Second)
+
+	envelope := NewEnvelope()
+	envelope.AddEvent(NewMessageEvent("hello", LevelInfo))
+	envelope.AddJSON(ItemSession, map[string]interface{}{"status": "ok"})
+	if !transport.SendEnvelope(envelope) {
+		t.Fatalf("Expected envelope to be queued")
+	}
+	if !transport.Flush(time.Second) {
+		t.Fatalf("Expected envelope to be delivered")
+	}
+
+	// Sessions are now rate limited and dropped from envelopes
+	if !transport.SendEnvelope(envelope) {
+		t.Fatalf("Expected envelope to be queued")
+	}
+	transport.Flush(time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []ItemType{ItemEvent, ItemSession, ItemEvent}
+	if len(items) != len(want) {
+		t.Fatalf("Expected items %v, got %v", want, items)
+	}
+	for i := range want {
+		if items[i] != want[i] {
+			t.Errorf("Expected items %v, got %v", want, items)
+		}
+	}
+}
+
+func TestHTTPTransportBatchesEnvelopes(t *testing.T) {
+	var mu sync.Mutex
+	var requests [][]ItemType
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		envelope, err := DecodeEnvelope(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var items []ItemType
+		for _, item := range envelope.Items {
+			items = append(items, item.Header.Type)
+		}
+		mu.Lock()
+		requests = append(requests, items)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{FlushPeriod: time.Hour})
+	defer transport.Close(time.Second)
+
+	for i := 0; i < 2; i++ {
+		envelope := NewEnvelope()
+		envelope.AddJSON(ItemSession, map[string]interface{}{"status": "ok"})
+		transport.SendEnvelope(envelope)
+	}
+	for i := 0; i < 2; i++ {
+		envelope := NewEnvelope()
+		envelope.AddEvent(NewMessageEvent("hello", LevelInfo))
+		transport.SendEnvelope(envelope)
+	}
+	attachment := NewEnvelope()
+	attachment.AddAttachment("a.txt", "text/plain", []byte("hello"))
+	transport.SendEnvelope(attachment)
+
+	if !transport.Flush(time.Second) {
+		t.Fatalf("Expected envelopes to be delivered")
+	}
+
+	// Sessions join the first event's envelope, while the second event and
+	// the attachment of no event need their own
+	mu.Lock()
+	defer mu.Unlock()
+	want := fmt.Sprint([][]ItemType{
+		{ItemSession, ItemSession, ItemEvent},
+		{ItemEvent},
+		{ItemAttachment},
+	})
+	if got := fmt.Sprint(requests); got != want {
+		t.Errorf("Expected requests %s, got %s", want, got)
+	}
+}
+
+func TestHTTPTransportEnvelopeBatchSize(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport := newTestHTTPTransport(server, TransportOptions{
+		BatchSize:   2,
+		FlushPeriod: time.Hour,
+	})
+	defer transport.Close(time.Second)
+
+	// A full batch of envelopes is sent without waiting for a flush
+	for i := 0; i < 2; i++ {
+		envelope := NewEnvelope()
+		envelope.AddJSON(ItemSession, map[string]interface{}{"status": "ok"})
+		transport.SendEnvelope(envelope)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&requests) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected 1 request, got %d", n)
+	}
+}